@@ -1,62 +1,72 @@
 package alertmanager
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
-	"strings"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/logging"
 )
 
+// RequestBody is the payload sent by the Alertmanager webhook receiver
+// (version 4 of the webhook schema).
 type RequestBody struct {
-	Alerts []Alert `json:"alerts"`
+	Version           string  `json:"version"`
+	GroupKey          string  `json:"groupKey"`
+	TruncatedAlerts   int     `json:"truncatedAlerts"`
+	Status            string  `json:"status"`
+	Receiver          string  `json:"receiver"`
+	GroupLabels       KV      `json:"groupLabels"`
+	CommonLabels      KV      `json:"commonLabels"`
+	CommonAnnotations KV      `json:"commonAnnotations"`
+	ExternalURL       string  `json:"externalURL"`
+	Alerts            []Alert `json:"alerts"`
 }
 
+// Alert is a single alert of a webhook payload.
 type Alert struct {
-	Status string `json:"status"`
-	Labels struct {
-		Alertname string `json:"alertname"`
-		Instance  string `json:"instance"`
-		Severity  string `json:"severity"`
-	} `json:"labels"`
-	Annotations struct {
-		Summary     string `json:"summary"`
-		Description string `json:"description"`
-		Priority    string `json:"priority"`
-	} `json:"annotations"`
+	Status       string    `json:"status"`
+	Labels       KV        `json:"labels"`
+	Annotations  KV        `json:"annotations"`
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string    `json:"fingerprint"`
 }
 
-func ParseAlert(alert Alert, defaultPriority int) (string, string, int) {
-	title := fmt.Sprintf("[%s][%s] ", strings.ToUpper(alert.Status), strings.ToUpper(alert.Labels.Severity))
-	if summary := alert.Annotations.Summary; len(summary) != 0 {
-		title += summary
-	} else {
-		log.Printf("Summary annotation not set in alert %s", alert.Labels.Alertname)
+// LogAttrs returns the attributes identifying the alert in the logs.
+func (a Alert) LogAttrs() []any {
+	return []any{
+		slog.String(logging.AlertnameKey, a.Labels["alertname"]),
+		slog.String(logging.FingerprintKey, a.Fingerprint),
+		slog.String(logging.StatusKey, a.Status),
 	}
+}
 
-	message := ""
-	if instance := alert.Labels.Instance; len(instance) != 0 {
-		message += fmt.Sprintf("[%s] ", alert.Labels.Instance)
-	}
+// KV is a set of label or annotation key/value pairs.
+type KV map[string]string
 
-	if description := alert.Annotations.Description; len(description) != 0 {
-		message += description
-	} else {
-		log.Printf("Description annotation not set in alert %s", alert.Labels.Alertname)
+// ParseAlert renders the title and message of the alert with the given
+// template and extracts its priority from the priority annotation.
+func ParseAlert(data *Data, tmpl *Template, defaultPriority int) (string, string, int, error) {
+	title, message, err := tmpl.Render(data)
+	if err != nil {
+		return "", "", 0, err
 	}
 
 	priority := 0
-	if priorityValue := alert.Annotations.Priority; len(priorityValue) != 0 {
+	if priorityValue := data.Annotations["priority"]; len(priorityValue) != 0 {
 		p, err := strconv.Atoi(priorityValue)
 		if err != nil {
-			log.Printf("Priority annotation value not valid in alert %s", alert.Labels.Alertname)
+			slog.Warn("Priority annotation value not valid, using the default priority", append(data.LogAttrs(), "priority", priorityValue)...)
 			priority = defaultPriority
 		} else {
 			priority = p
 		}
 	} else {
-		log.Printf("Priority annotation not set in alert %s", alert.Labels.Alertname)
+		slog.Debug("Priority annotation not set, using the default priority", data.LogAttrs()...)
 		priority = defaultPriority
 	}
 
-	return title, message, priority
+	return title, message, priority, nil
 }
@@ -1,23 +1,90 @@
 package alertmanager
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 )
 
+const webhookPayload = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"HighLatency\"}",
+  "truncatedAlerts": 1,
+  "status": "firing",
+  "receiver": "notifier",
+  "groupLabels": {"alertname": "HighLatency"},
+  "commonLabels": {"alertname": "HighLatency", "team": "db"},
+  "commonAnnotations": {"runbook": "https://runbooks/latency"},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "HighLatency", "team": "db", "instance": "db-1"},
+      "annotations": {"summary": "Latency is high"},
+      "startsAt": "2024-05-01T10:00:00Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://prometheus:9090/graph",
+      "fingerprint": "c6a7a0a1b2c3d4e5"
+    }
+  ]
+}`
+
+func Test_decodeRequestBody(t *testing.T) {
+	var body RequestBody
+	err := json.Unmarshal([]byte(webhookPayload), &body)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding payload: %s", err)
+	}
+
+	if body.Version != "4" || body.Receiver != "notifier" || body.Status != "firing" || body.TruncatedAlerts != 1 {
+		t.Errorf("Payload metadata was incorrect, got: %+v", body)
+	}
+	if body.GroupKey != `{}:{alertname="HighLatency"}` {
+		t.Errorf("Group key was incorrect, got: %+v", body.GroupKey)
+	}
+	if body.GroupLabels["alertname"] != "HighLatency" || body.CommonLabels["team"] != "db" {
+		t.Errorf("Group or common labels were incorrect, got: %+v %+v", body.GroupLabels, body.CommonLabels)
+	}
+	if body.CommonAnnotations["runbook"] != "https://runbooks/latency" {
+		t.Errorf("Common annotations were incorrect, got: %+v", body.CommonAnnotations)
+	}
+	if body.ExternalURL != "http://alertmanager:9093" {
+		t.Errorf("External URL was incorrect, got: %+v", body.ExternalURL)
+	}
+	if len(body.Alerts) != 1 {
+		t.Fatalf("Number of alerts was incorrect want: 1, but got: %d", len(body.Alerts))
+	}
+
+	alert := body.Alerts[0]
+	if alert.Labels["instance"] != "db-1" || alert.Annotations["summary"] != "Latency is high" {
+		t.Errorf("Alert labels or annotations were incorrect, got: %+v %+v", alert.Labels, alert.Annotations)
+	}
+	expectedStartsAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if !alert.StartsAt.Equal(expectedStartsAt) || !alert.EndsAt.IsZero() {
+		t.Errorf("Alert timestamps were incorrect, got: %+v %+v", alert.StartsAt, alert.EndsAt)
+	}
+	if alert.GeneratorURL != "http://prometheus:9090/graph" || alert.Fingerprint != "c6a7a0a1b2c3d4e5" {
+		t.Errorf("Alert generator URL or fingerprint were incorrect, got: %+v %+v", alert.GeneratorURL, alert.Fingerprint)
+	}
+}
+
 func Test_parseAlert(t *testing.T) {
 	expectedTitle := "[FIRING][WARNING] Summary"
 	expectedMessage := "[instance] Description"
 	expectedPriority := 2
 
-	var alert Alert
+	alert := Alert{Labels: KV{}, Annotations: KV{}}
 	alert.Status = "firing"
-	alert.Labels.Alertname = "Test alert"
-	alert.Labels.Instance = "instance"
-	alert.Labels.Severity = "warning"
-	alert.Annotations.Summary = "Summary"
-	alert.Annotations.Description = "Description"
-	alert.Annotations.Priority = "2"
-	actualTitle, actualMessage, actualPriority := ParseAlert(alert, 5)
+	alert.Labels["alertname"] = "Test alert"
+	alert.Labels["instance"] = "instance"
+	alert.Labels["severity"] = "warning"
+	alert.Annotations["summary"] = "Summary"
+	alert.Annotations["description"] = "Description"
+	alert.Annotations["priority"] = "2"
+	actualTitle, actualMessage, actualPriority, err := ParseAlert(NewData(RequestBody{}, alert), DefaultTemplate(), 5)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing alert: %s", err)
+	}
 
 	if expectedTitle != actualTitle {
 		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
@@ -35,14 +102,17 @@ func Test_parseAlert_noInstance(t *testing.T) {
 	expectedMessage := "Description"
 	expectedPriority := 2
 
-	var alert Alert
+	alert := Alert{Labels: KV{}, Annotations: KV{}}
 	alert.Status = "firing"
-	alert.Labels.Alertname = "Test alert"
-	alert.Labels.Severity = "warning"
-	alert.Annotations.Summary = "Summary"
-	alert.Annotations.Description = "Description"
-	alert.Annotations.Priority = "2"
-	actualTitle, actualMessage, actualPriority := ParseAlert(alert, 5)
+	alert.Labels["alertname"] = "Test alert"
+	alert.Labels["severity"] = "warning"
+	alert.Annotations["summary"] = "Summary"
+	alert.Annotations["description"] = "Description"
+	alert.Annotations["priority"] = "2"
+	actualTitle, actualMessage, actualPriority, err := ParseAlert(NewData(RequestBody{}, alert), DefaultTemplate(), 5)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing alert: %s", err)
+	}
 
 	if expectedTitle != actualTitle {
 		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
@@ -60,14 +130,17 @@ func Test_parseAlarm_noSummary(t *testing.T) {
 	expectedMessage := "[instance] Description"
 	expectedPriority := 2
 
-	var alert Alert
+	alert := Alert{Labels: KV{}, Annotations: KV{}}
 	alert.Status = "firing"
-	alert.Labels.Alertname = "Test alert"
-	alert.Labels.Instance = "instance"
-	alert.Labels.Severity = "warning"
-	alert.Annotations.Description = "Description"
-	alert.Annotations.Priority = "2"
-	actualTitle, actualMessage, actualPriority := ParseAlert(alert, 5)
+	alert.Labels["alertname"] = "Test alert"
+	alert.Labels["instance"] = "instance"
+	alert.Labels["severity"] = "warning"
+	alert.Annotations["description"] = "Description"
+	alert.Annotations["priority"] = "2"
+	actualTitle, actualMessage, actualPriority, err := ParseAlert(NewData(RequestBody{}, alert), DefaultTemplate(), 5)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing alert: %s", err)
+	}
 
 	if expectedTitle != actualTitle {
 		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
@@ -85,14 +158,17 @@ func Test_parseAlert_noDescription(t *testing.T) {
 	expectedMessage := "[instance] "
 	expectedPriority := 2
 
-	var alert Alert
+	alert := Alert{Labels: KV{}, Annotations: KV{}}
 	alert.Status = "firing"
-	alert.Labels.Alertname = "Test alert"
-	alert.Labels.Instance = "instance"
-	alert.Labels.Severity = "warning"
-	alert.Annotations.Summary = "Summary"
-	alert.Annotations.Priority = "2"
-	actualTitle, actualMessage, actualPriority := ParseAlert(alert, 5)
+	alert.Labels["alertname"] = "Test alert"
+	alert.Labels["instance"] = "instance"
+	alert.Labels["severity"] = "warning"
+	alert.Annotations["summary"] = "Summary"
+	alert.Annotations["priority"] = "2"
+	actualTitle, actualMessage, actualPriority, err := ParseAlert(NewData(RequestBody{}, alert), DefaultTemplate(), 5)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing alert: %s", err)
+	}
 
 	if expectedTitle != actualTitle {
 		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
@@ -110,14 +186,17 @@ func Test_parseAlert_noPriority(t *testing.T) {
 	expectedMessage := "[instance] Description"
 	expectedPriority := 5
 
-	var alert Alert
+	alert := Alert{Labels: KV{}, Annotations: KV{}}
 	alert.Status = "firing"
-	alert.Labels.Alertname = "Test alert"
-	alert.Labels.Instance = "instance"
-	alert.Labels.Severity = "warning"
-	alert.Annotations.Summary = "Summary"
-	alert.Annotations.Description = "Description"
-	actualTitle, actualMessage, actualPriority := ParseAlert(alert, 5)
+	alert.Labels["alertname"] = "Test alert"
+	alert.Labels["instance"] = "instance"
+	alert.Labels["severity"] = "warning"
+	alert.Annotations["summary"] = "Summary"
+	alert.Annotations["description"] = "Description"
+	actualTitle, actualMessage, actualPriority, err := ParseAlert(NewData(RequestBody{}, alert), DefaultTemplate(), 5)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing alert: %s", err)
+	}
 
 	if expectedTitle != actualTitle {
 		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
@@ -135,15 +214,18 @@ func Test_parseAlert_wrongPriority(t *testing.T) {
 	expectedMessage := "[instance] Description"
 	expectedPriority := 5
 
-	var alert Alert
+	alert := Alert{Labels: KV{}, Annotations: KV{}}
 	alert.Status = "firing"
-	alert.Labels.Alertname = "Test alert"
-	alert.Labels.Instance = "instance"
-	alert.Labels.Severity = "warning"
-	alert.Annotations.Summary = "Summary"
-	alert.Annotations.Description = "Description"
-	alert.Annotations.Priority = "wrong"
-	actualTitle, actualMessage, actualPriority := ParseAlert(alert, 5)
+	alert.Labels["alertname"] = "Test alert"
+	alert.Labels["instance"] = "instance"
+	alert.Labels["severity"] = "warning"
+	alert.Annotations["summary"] = "Summary"
+	alert.Annotations["description"] = "Description"
+	alert.Annotations["priority"] = "wrong"
+	actualTitle, actualMessage, actualPriority, err := ParseAlert(NewData(RequestBody{}, alert), DefaultTemplate(), 5)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing alert: %s", err)
+	}
 
 	if expectedTitle != actualTitle {
 		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
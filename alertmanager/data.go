@@ -0,0 +1,141 @@
+package alertmanager
+
+import (
+	"sort"
+	"strings"
+)
+
+// Data is the data passed to the notification templates. It mirrors the
+// data Alertmanager passes to its own notification templates, so templates
+// can be shared with Alertmanager receivers. Notifications are sent per
+// alert, so Alerts only holds the alert being notified, whose fields are also
+// accessible at the top level (.Status, .Labels, .Annotations, ...).
+type Data struct {
+	Alert
+
+	Receiver          string
+	Alerts            Alerts
+	GroupLabels       KV
+	CommonLabels      KV
+	CommonAnnotations KV
+	ExternalURL       string
+}
+
+// NewData returns the template data used to notify an alert of the webhook
+// payload body.
+func NewData(body RequestBody, alert Alert) *Data {
+	return &Data{
+		Alert:             alert,
+		Receiver:          body.Receiver,
+		Alerts:            Alerts{alert},
+		GroupLabels:       body.GroupLabels,
+		CommonLabels:      body.CommonLabels,
+		CommonAnnotations: body.CommonAnnotations,
+		ExternalURL:       body.ExternalURL,
+	}
+}
+
+// Alerts is a list of alerts.
+type Alerts []Alert
+
+// Firing returns the subset of alerts that are firing.
+func (as Alerts) Firing() []Alert {
+	return as.withStatus("firing")
+}
+
+// Resolved returns the subset of alerts that are resolved.
+func (as Alerts) Resolved() []Alert {
+	return as.withStatus("resolved")
+}
+
+func (as Alerts) withStatus(status string) []Alert {
+	alerts := []Alert{}
+	for _, a := range as {
+		if a.Status == status {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+// Pair is a key/value string pair.
+type Pair struct {
+	Name, Value string
+}
+
+// Pairs is a list of key/value string pairs.
+type Pairs []Pair
+
+// Names returns the names of the pairs.
+func (ps Pairs) Names() []string {
+	names := make([]string, 0, len(ps))
+	for _, p := range ps {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Values returns the values of the pairs.
+func (ps Pairs) Values() []string {
+	values := make([]string, 0, len(ps))
+	for _, p := range ps {
+		values = append(values, p.Value)
+	}
+	return values
+}
+
+// String returns the pairs formatted as "name1=value1, name2=value2".
+func (ps Pairs) String() string {
+	pairs := make([]string, 0, len(ps))
+	for _, p := range ps {
+		pairs = append(pairs, p.Name+"="+p.Value)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// SortedPairs returns the key/value pairs sorted by name, with the alertname
+// first as Alertmanager does.
+func (kv KV) SortedPairs() Pairs {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		if k != "alertname" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := kv["alertname"]; ok {
+		keys = append([]string{"alertname"}, keys...)
+	}
+
+	pairs := make(Pairs, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, Pair{k, kv[k]})
+	}
+	return pairs
+}
+
+// Remove returns a copy of the key/value set without the given keys.
+func (kv KV) Remove(keys []string) KV {
+	removed := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		removed[k] = true
+	}
+
+	result := KV{}
+	for k, v := range kv {
+		if !removed[k] {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// Names returns the sorted names of the key/value set.
+func (kv KV) Names() []string {
+	return kv.SortedPairs().Names()
+}
+
+// Values returns the values of the key/value set sorted by name.
+func (kv KV) Values() []string {
+	return kv.SortedPairs().Values()
+}
@@ -0,0 +1,63 @@
+package alertmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_kvSortedPairs(t *testing.T) {
+	expectedPairs := Pairs{{"alertname", "HighLatency"}, {"instance", "db-1"}, {"team", "db"}}
+
+	kv := KV{"team": "db", "instance": "db-1", "alertname": "HighLatency"}
+	actualPairs := kv.SortedPairs()
+
+	if !reflect.DeepEqual(expectedPairs, actualPairs) {
+		t.Errorf("Sorted pairs were incorrect want: %+v, but got: %+v", expectedPairs, actualPairs)
+	}
+}
+
+func Test_kvRemove(t *testing.T) {
+	expectedKV := KV{"team": "db"}
+
+	kv := KV{"team": "db", "instance": "db-1"}
+	actualKV := kv.Remove([]string{"instance"})
+
+	if !reflect.DeepEqual(expectedKV, actualKV) {
+		t.Errorf("KV was incorrect want: %+v, but got: %+v", expectedKV, actualKV)
+	}
+	if len(kv) != 2 {
+		t.Errorf("Remove should not modify the original KV, but got: %+v", kv)
+	}
+}
+
+func Test_alertsFiring(t *testing.T) {
+	alerts := Alerts{{Status: "firing"}, {Status: "resolved"}, {Status: "firing"}}
+
+	if firing := alerts.Firing(); len(firing) != 2 {
+		t.Errorf("Firing alerts were incorrect want: 2, but got: %d", len(firing))
+	}
+	if resolved := alerts.Resolved(); len(resolved) != 1 {
+		t.Errorf("Resolved alerts were incorrect want: 1, but got: %d", len(resolved))
+	}
+}
+
+func Test_newData(t *testing.T) {
+	body := RequestBody{
+		Receiver:     "notifier",
+		CommonLabels: KV{"team": "db"},
+		ExternalURL:  "http://alertmanager:9093",
+		Alerts:       []Alert{{Status: "firing", Fingerprint: "1"}, {Status: "resolved", Fingerprint: "2"}},
+	}
+
+	data := NewData(body, body.Alerts[1])
+
+	if data.Status != "resolved" || data.Fingerprint != "2" {
+		t.Errorf("Alert fields were incorrect, got: %+v", data.Alert)
+	}
+	if len(data.Alerts) != 1 || data.Alerts[0].Fingerprint != "2" {
+		t.Errorf("Alerts should only contain the notified alert, but got: %+v", data.Alerts)
+	}
+	if data.Receiver != "notifier" || data.CommonLabels["team"] != "db" || data.ExternalURL != "http://alertmanager:9093" {
+		t.Errorf("Group fields were incorrect, got: %+v", data)
+	}
+}
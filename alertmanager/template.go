@@ -0,0 +1,273 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultTitleTemplate   = `[{{ .Status | toUpper }}][{{ .Labels.severity | toUpper }}] {{ .Annotations.summary }}`
+	DefaultMessageTemplate = `{{ with .Labels.instance }}[{{ . }}] {{ end }}{{ .Annotations.description }}`
+)
+
+const (
+	titleTemplateName   = "__title"
+	messageTemplateName = "__message"
+)
+
+// Template renders the title and message of the notification sent for an
+// alert.
+type Template struct {
+	tmpl *template.Template
+}
+
+// NewTemplate parses the title and message templates along with the
+// template files matching the given glob patterns, so the title and message
+// can use the templates defined in them. Empty title or message fall back to
+// the default templates.
+func NewTemplate(title string, message string, patterns ...string) (*Template, error) {
+	if len(title) == 0 {
+		title = DefaultTitleTemplate
+	}
+	if len(message) == 0 {
+		message = DefaultMessageTemplate
+	}
+
+	tmpl := template.New("").Option("missingkey=zero").Funcs(templateFuncs)
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template files pattern %s: %s", pattern, err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		tmpl, err = tmpl.ParseFiles(files...)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse template files: %s", err)
+		}
+	}
+
+	_, err := tmpl.New(titleTemplateName).Parse(title)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse title template: %s", err)
+	}
+	_, err = tmpl.New(messageTemplateName).Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse message template: %s", err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// DefaultTemplate returns the template rendering the default title and
+// message.
+func DefaultTemplate() *Template {
+	t, err := NewTemplate(DefaultTitleTemplate, DefaultMessageTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes the title and message templates against the data.
+func (t *Template) Render(data *Data) (string, string, error) {
+	title, err := t.execute(titleTemplateName, data)
+	if err != nil {
+		return "", "", fmt.Errorf("could not render title template: %s", err)
+	}
+	message, err := t.execute(messageTemplateName, data)
+	if err != nil {
+		return "", "", fmt.Errorf("could not render message template: %s", err)
+	}
+	return title, message, nil
+}
+
+// With returns a copy of the template with the extra templates, by name,
+// like the body of a webhook. They can use the same functions and the
+// templates defined in the template files as the title and message.
+func (t *Template) With(templates map[string]string) (*Template, error) {
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for name, text := range templates {
+		_, err = tmpl.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s template: %s", name, err)
+		}
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Execute renders the extra template with the given name against data.
+func (t *Template) Execute(name string, data any) (string, error) {
+	var buffer bytes.Buffer
+	err := t.tmpl.ExecuteTemplate(&buffer, name, data)
+	if err != nil {
+		return "", fmt.Errorf("could not render %s template: %s", name, err)
+	}
+	return buffer.String(), nil
+}
+
+func (t *Template) execute(name string, data *Data) (string, error) {
+	var buffer bytes.Buffer
+	err := t.tmpl.ExecuteTemplate(&buffer, name, data)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// templateFuncs are the functions available to the templates. They are a
+// superset of the functions available to Alertmanager notification templates.
+var templateFuncs = template.FuncMap{
+	"toUpper":          strings.ToUpper,
+	"toLower":          strings.ToLower,
+	"title":            title,
+	"trimSpace":        strings.TrimSpace,
+	"default":          defaultValue,
+	"join":             join,
+	"match":            regexp.MatchString,
+	"safeHtml":         safeHTML,
+	"safeUrl":          safeURL,
+	"urlUnescape":      url.QueryUnescape,
+	"reReplaceAll":     reReplaceAll,
+	"stringSlice":      stringSlice,
+	"toJson":           toJSON,
+	"since":            time.Since,
+	"humanizeDuration": humanizeDuration,
+	"date":             date,
+	"tz":               tz,
+}
+
+func title(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(r)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// defaultValue returns def when value is the zero value of its type, so it
+// can be used as {{ .Labels.severity | default "none" }}.
+func defaultValue(def any, value any) any {
+	if value == nil {
+		return def
+	}
+	if v := reflect.ValueOf(value); v.IsZero() {
+		return def
+	}
+	return value
+}
+
+func join(separator string, values []string) string {
+	return strings.Join(values, separator)
+}
+
+func safeHTML(text string) htmltemplate.HTML {
+	return htmltemplate.HTML(text)
+}
+
+func safeURL(text string) htmltemplate.URL {
+	return htmltemplate.URL(text)
+}
+
+func reReplaceAll(pattern string, replacement string, text string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(text, replacement), nil
+}
+
+func stringSlice(values ...string) []string {
+	return values
+}
+
+func toJSON(value any) (string, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// tz converts t to the location with the given IANA name, e.g.
+// {{ .StartsAt | tz "Europe/Madrid" | date "15:04" }}.
+func tz(name string, t time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(location), nil
+}
+
+// date formats t with the Go reference time layout, e.g.
+// {{ .StartsAt | date "2006-01-02 15:04:05" }}.
+func date(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// humanizeDuration formats a time.Duration or a number of seconds as a
+// human readable duration like "1d 2h 3m 4s".
+func humanizeDuration(value any) (string, error) {
+	var seconds float64
+	switch v := value.(type) {
+	case time.Duration:
+		seconds = v.Seconds()
+	case int:
+		seconds = float64(v)
+	case int64:
+		seconds = float64(v)
+	case float64:
+		seconds = v
+	default:
+		return "", fmt.Errorf("humanizeDuration: unsupported value %v of type %T", value, value)
+	}
+
+	if math.Abs(seconds) < 1 {
+		if seconds == 0 {
+			return "0s", nil
+		}
+		return fmt.Sprintf("%.4gms", seconds*1000), nil
+	}
+
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	total := int64(seconds)
+	days := total / 86400
+	hours := total / 3600 % 24
+	minutes := total / 60 % 60
+	secs := total % 60
+
+	parts := []string{}
+	if days != 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours != 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes != 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if secs != 0 {
+		parts = append(parts, fmt.Sprintf("%ds", secs))
+	}
+	return sign + strings.Join(parts, " "), nil
+}
@@ -0,0 +1,178 @@
+package alertmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_templateRender(t *testing.T) {
+	expectedTitle := "Firing: HighLatency (db)"
+	expectedMessage := "Since 2024-05-01 10:00 on DB-1"
+
+	tmpl, err := NewTemplate(
+		`{{ .Status | title }}: {{ .Labels.alertname }} ({{ .Labels.team | default "none" }})`,
+		`Since {{ .StartsAt | date "2006-01-02 15:04" }} on {{ .Labels.instance | toUpper }}`,
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing templates: %s", err)
+	}
+
+	alert := Alert{
+		Status:   "firing",
+		Labels:   KV{"alertname": "HighLatency", "team": "db", "instance": "db-1"},
+		StartsAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	actualTitle, actualMessage, err := tmpl.Render(NewData(RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error rendering templates: %s", err)
+	}
+	if expectedTitle != actualTitle {
+		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
+	}
+	if expectedMessage != actualMessage {
+		t.Errorf("Message was incorrect want: \"%+v\", but got: \"%+v\"", expectedMessage, actualMessage)
+	}
+}
+
+func Test_templateRender_unknownField(t *testing.T) {
+	tmpl, err := NewTemplate("{{ .Unknown }}", "")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing templates: %s", err)
+	}
+
+	_, _, err = tmpl.Render(NewData(RequestBody{}, Alert{}))
+	if err == nil {
+		t.Errorf("Expected an error rendering a field that does not exist")
+	}
+}
+
+func Test_templateRender_defaultValue(t *testing.T) {
+	expectedTitle := "none"
+
+	tmpl, err := NewTemplate(`{{ .Labels.team | default "none" }}`, "")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing templates: %s", err)
+	}
+
+	actualTitle, _, err := tmpl.Render(NewData(RequestBody{}, Alert{}))
+	if err != nil {
+		t.Fatalf("Unexpected error rendering title: %s", err)
+	}
+	if expectedTitle != actualTitle {
+		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
+	}
+}
+
+func Test_templateRender_files(t *testing.T) {
+	expectedTitle := "[Firing:1] HighLatency"
+	expectedMessage := "alertname=HighLatency, team=db-cluster"
+
+	dir := t.TempDir()
+	content := `{{ define "custom.title" }}[{{ .Status | title }}:{{ .Alerts.Firing | len }}] {{ .CommonLabels.alertname }}{{ end }}
+{{ define "custom.message" }}{{ .CommonLabels.SortedPairs }}{{ end }}`
+	err := os.WriteFile(filepath.Join(dir, "custom.tmpl"), []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("Unexpected error writing template file: %s", err)
+	}
+
+	tmpl, err := NewTemplate(`{{ template "custom.title" . }}`, `{{ template "custom.message" . }}`, filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing templates: %s", err)
+	}
+
+	alert := Alert{Status: "firing", Labels: KV{"alertname": "HighLatency"}}
+	body := RequestBody{CommonLabels: KV{"team": "db-cluster", "alertname": "HighLatency"}, Alerts: []Alert{alert}}
+	actualTitle, actualMessage, err := tmpl.Render(NewData(body, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error rendering templates: %s", err)
+	}
+	if expectedTitle != actualTitle {
+		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
+	}
+	if expectedMessage != actualMessage {
+		t.Errorf("Message was incorrect want: \"%+v\", but got: \"%+v\"", expectedMessage, actualMessage)
+	}
+}
+
+func Test_templateRender_alertmanagerFunctions(t *testing.T) {
+	expectedTitle := "db/1 [a b]"
+
+	tmpl, err := NewTemplate(`{{ reReplaceAll "-cluster-(.*)" "/$1" .Labels.team }} {{ stringSlice "a" "b" }}`, "")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing templates: %s", err)
+	}
+
+	actualTitle, _, err := tmpl.Render(NewData(RequestBody{}, Alert{Labels: KV{"team": "db-cluster-1"}}))
+	if err != nil {
+		t.Fatalf("Unexpected error rendering templates: %s", err)
+	}
+	if expectedTitle != actualTitle {
+		t.Errorf("Title was incorrect want: \"%+v\", but got: \"%+v\"", expectedTitle, actualTitle)
+	}
+}
+
+func Test_newTemplate_invalid(t *testing.T) {
+	_, err := NewTemplate("{{ .Status ", "")
+	if err == nil {
+		t.Errorf("Expected an error parsing an invalid template")
+	}
+}
+
+func Test_templateWith(t *testing.T) {
+	expectedBody := `{"title":"[FIRING][CRITICAL] Disk full","team":"db"}`
+
+	tmpl, err := NewTemplate(`{{ define "team" }}{{ .Labels.team | toJson }}{{ end }}{{ .Status }}`, "")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing templates: %s", err)
+	}
+	extended, err := tmpl.With(map[string]string{"body": `{"title":{{ toJson .Title }},"team":{{ template "team" .Data }}}`})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing extra templates: %s", err)
+	}
+
+	alert := Alert{Status: "firing", Labels: KV{"severity": "critical", "team": "db"}, Annotations: KV{"summary": "Disk full"}}
+	data := NewData(RequestBody{}, alert)
+	actualBody, err := extended.Execute("body", struct {
+		Data  *Data
+		Title string
+	}{data, "[FIRING][CRITICAL] Disk full"})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering extra template: %s", err)
+	}
+	if expectedBody != actualBody {
+		t.Errorf("Body was incorrect want: \"%+v\", but got: \"%+v\"", expectedBody, actualBody)
+	}
+
+	_, err = tmpl.Execute("body", data)
+	if err == nil {
+		t.Errorf("Extra templates should not be added to the original template")
+	}
+	_, err = tmpl.With(map[string]string{"body": "{{ .Title "})
+	if err == nil {
+		t.Errorf("Expected an error parsing an invalid extra template")
+	}
+}
+
+func Test_humanizeDuration(t *testing.T) {
+	tests := map[any]string{
+		0:                               "0s",
+		90:                              "1m 30s",
+		3600.0:                          "1h",
+		93784:                           "1d 2h 3m 4s",
+		2*time.Hour + 5*time.Second:     "2h 5s",
+		-(time.Minute + 10*time.Second): "-1m 10s",
+		500 * time.Millisecond:          "500ms",
+	}
+
+	for value, expected := range tests {
+		actual, err := humanizeDuration(value)
+		if err != nil {
+			t.Fatalf("Unexpected error humanizing %v: %s", value, err)
+		}
+		if expected != actual {
+			t.Errorf("Duration was incorrect want: \"%+v\", but got: \"%+v\"", expected, actual)
+		}
+	}
+}
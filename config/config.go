@@ -0,0 +1,318 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dcasado/alertmanager-notifier/logging"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+)
+
+const (
+	listenAddressEnvVariable = "LISTEN_ADDRESS"
+	listenPortEnvVariable    = "LISTEN_PORT"
+	logLevelEnvVariable      = "LOG_LEVEL"
+	logFormatEnvVariable     = "LOG_FORMAT"
+	notifierTypeEnvVariable  = "NOTIFIER_TYPE"
+
+	titleTemplateEnvVariable       = "TITLE_TEMPLATE"
+	titleTemplateFileEnvVariable   = "TITLE_TEMPLATE_FILE"
+	messageTemplateEnvVariable     = "MESSAGE_TEMPLATE"
+	messageTemplateFileEnvVariable = "MESSAGE_TEMPLATE_FILE"
+	templateFilesEnvVariable       = "TEMPLATE_FILES"
+
+	deliveryTrackingTTLMillisEnvVariable = "DELIVERY_TRACKING_TTL_MILLIS"
+	queueDirectoryEnvVariable            = "QUEUE_DIRECTORY"
+	deadLettersDirectoryEnvVariable      = "DEAD_LETTERS_DIRECTORY"
+	readyCacheMillisEnvVariable          = "READY_CACHE_MILLIS"
+	tracingEndpointEnvVariable           = "OTEL_EXPORTER_OTLP_ENDPOINT"
+)
+
+// Config is the configuration of the service.
+type Config struct {
+	Listen      ListenConfig              `yaml:"listen"`
+	Log         LogConfig                 `yaml:"log"`
+	Delivery    DeliveryConfig            `yaml:"delivery"`
+	Queue       QueueConfig               `yaml:"queue"`
+	DeadLetters DeadLettersConfig         `yaml:"dead_letters"`
+	Ready       ReadyConfig               `yaml:"ready"`
+	Tracing     TracingConfig             `yaml:"tracing"`
+	Templates   TemplatesConfig           `yaml:"templates"`
+	Notifiers   []notifier.Config         `yaml:"notifiers"`
+	Route       *notifier.RouteConfig     `yaml:"route"`
+	Receivers   []notifier.ReceiverConfig `yaml:"receivers"`
+}
+
+// ListenConfig configures where the service listens on.
+type ListenConfig struct {
+	Address string `yaml:"address"`
+	Port    string `yaml:"port"`
+}
+
+// LogConfig configures the logs.
+type LogConfig struct {
+	// Level is the minimum level of the lines logged: debug, info, warn or
+	// error.
+	Level string `yaml:"level"`
+	// Format is the format of the lines: text or json.
+	Format string `yaml:"format"`
+}
+
+// DeliveryConfig configures how alerts are delivered.
+type DeliveryConfig struct {
+	// TrackingTTLMillis is how long delivered alerts are remembered to avoid
+	// delivering them again when Alertmanager retries a webhook.
+	TrackingTTLMillis int `yaml:"tracking_ttl_millis"`
+}
+
+// QueueConfig configures the durable queue. Alerts are queued and delivered
+// asynchronously only when Directory is set.
+type QueueConfig struct {
+	Directory         string `yaml:"directory"`
+	Workers           int    `yaml:"workers"`
+	MaxAttempts       int    `yaml:"max_attempts"`
+	BaseBackoffMillis int    `yaml:"base_backoff_millis"`
+	MaxBackoffMillis  int    `yaml:"max_backoff_millis"`
+}
+
+// DeadLettersConfig configures the store of the notifications that could not
+// be delivered. They are only kept in memory when Directory is not set.
+type DeadLettersConfig struct {
+	Directory  string `yaml:"directory"`
+	MaxEntries int    `yaml:"max_entries"`
+}
+
+// ReadyConfig configures the readiness check of the notifier destinations.
+type ReadyConfig struct {
+	// CacheMillis is how long the result of probing a destination is
+	// reused.
+	CacheMillis int `yaml:"cache_millis"`
+}
+
+// TracingConfig configures the export of the traces. Tracing is disabled
+// unless Endpoint is set.
+type TracingConfig struct {
+	// Endpoint is the base URL of the OTLP/HTTP collector, e.g.
+	// http://otel-collector:4318.
+	Endpoint string `yaml:"endpoint"`
+	// SampleRatio is the ratio of the traces started by the service that
+	// are sampled, up to 1, the default.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// TemplatesConfig configures the notification templates.
+type TemplatesConfig struct {
+	Title   string   `yaml:"title"`
+	Message string   `yaml:"message"`
+	Files   []string `yaml:"files"`
+}
+
+var envReferenceRegexp = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// Load reads the configuration file at path, if any, and applies the
+// environment variables over it. ${VAR} references in the file are replaced
+// by the value of the environment variable VAR. The notifier environment
+// variables don't override the notifiers of the file: they only provide the
+// fields the file doesn't set, when the notifiers are created, as they can't
+// tell apart several notifiers of the same type. NOTIFIER_TYPE is only used
+// when the file defines no notifiers.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if len(path) != 0 {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read configuration file: %s", err)
+		}
+		content = envReferenceRegexp.ReplaceAllFunc(content, func(reference []byte) []byte {
+			return []byte(os.Getenv(string(reference[2 : len(reference)-1])))
+		})
+
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse configuration file: %s", err)
+		}
+	}
+
+	err := config.applyEnvVariables()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) applyEnvVariables() error {
+	err := c.Log.applyEnvVariables()
+	if err != nil {
+		return err
+	}
+
+	if value := os.Getenv(listenAddressEnvVariable); len(value) != 0 {
+		c.Listen.Address = value
+	} else if len(c.Listen.Address) == 0 {
+		c.Listen.Address = "127.0.0.1"
+	}
+	if value := os.Getenv(listenPortEnvVariable); len(value) != 0 {
+		c.Listen.Port = value
+	} else if len(c.Listen.Port) == 0 {
+		c.Listen.Port = "8080"
+	}
+
+	if value := os.Getenv(deliveryTrackingTTLMillisEnvVariable); len(value) != 0 {
+		ttl, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, must be a number", deliveryTrackingTTLMillisEnvVariable, value)
+		}
+		c.Delivery.TrackingTTLMillis = ttl
+	} else if c.Delivery.TrackingTTLMillis == 0 {
+		c.Delivery.TrackingTTLMillis = 3600000
+	}
+	if c.Delivery.TrackingTTLMillis < 1 {
+		return fmt.Errorf("invalid delivery tracking ttl %d, must be a number greater than 0", c.Delivery.TrackingTTLMillis)
+	}
+
+	err = c.Queue.applyEnvVariables()
+	if err != nil {
+		return err
+	}
+
+	if value := os.Getenv(deadLettersDirectoryEnvVariable); len(value) != 0 {
+		c.DeadLetters.Directory = value
+	}
+	if c.DeadLetters.MaxEntries == 0 {
+		c.DeadLetters.MaxEntries = 1000
+	}
+	if c.DeadLetters.MaxEntries < 1 {
+		return fmt.Errorf("invalid dead letters max entries %d, must be a number greater than 0", c.DeadLetters.MaxEntries)
+	}
+
+	if value := os.Getenv(readyCacheMillisEnvVariable); len(value) != 0 {
+		cacheMillis, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, must be a number", readyCacheMillisEnvVariable, value)
+		}
+		c.Ready.CacheMillis = cacheMillis
+	} else if c.Ready.CacheMillis == 0 {
+		c.Ready.CacheMillis = 10000
+	}
+	if c.Ready.CacheMillis < 1 {
+		return fmt.Errorf("invalid ready cache time %d, must be a number greater than 0", c.Ready.CacheMillis)
+	}
+
+	if value := os.Getenv(tracingEndpointEnvVariable); len(value) != 0 {
+		c.Tracing.Endpoint = value
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("invalid tracing sample ratio %g, must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	title, err := getTemplateEnvVariable(titleTemplateEnvVariable, titleTemplateFileEnvVariable)
+	if err != nil {
+		return err
+	}
+	if len(title) != 0 {
+		c.Templates.Title = title
+	}
+	message, err := getTemplateEnvVariable(messageTemplateEnvVariable, messageTemplateFileEnvVariable)
+	if err != nil {
+		return err
+	}
+	if len(message) != 0 {
+		c.Templates.Message = message
+	}
+	if value := os.Getenv(templateFilesEnvVariable); len(value) != 0 {
+		c.Templates.Files = strings.Split(value, ",")
+	}
+
+	if len(c.Notifiers) == 0 {
+		for _, notifierType := range getNotifierTypesEnvVariable() {
+			c.Notifiers = append(c.Notifiers, notifier.Config{Name: notifierType, Type: notifierType})
+		}
+	}
+	return nil
+}
+
+func (c *LogConfig) applyEnvVariables() error {
+	if value := os.Getenv(logLevelEnvVariable); len(value) != 0 {
+		c.Level = value
+	} else if len(c.Level) == 0 {
+		c.Level = "info"
+	}
+	if value := os.Getenv(logFormatEnvVariable); len(value) != 0 {
+		c.Format = value
+	} else if len(c.Format) == 0 {
+		c.Format = logging.TextFormat
+	}
+
+	_, err := logging.ParseLevel(c.Level)
+	return errors.Join(err, logging.ValidateFormat(c.Format))
+}
+
+func (c *QueueConfig) applyEnvVariables() error {
+	if value := os.Getenv(queueDirectoryEnvVariable); len(value) != 0 {
+		c.Directory = value
+	}
+	if c.Workers == 0 {
+		c.Workers = 1
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 10
+	}
+	if c.BaseBackoffMillis == 0 {
+		c.BaseBackoffMillis = 1000
+	}
+	if c.MaxBackoffMillis == 0 {
+		c.MaxBackoffMillis = 300000
+	}
+
+	errs := []error{}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("invalid queue workers %d, must be a number greater than 0", c.Workers))
+	}
+	if c.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("invalid queue max attempts %d, must be a number greater than 0", c.MaxAttempts))
+	}
+	if c.BaseBackoffMillis < 1 || c.MaxBackoffMillis < c.BaseBackoffMillis {
+		errs = append(errs, fmt.Errorf("invalid queue backoff, base and max backoff must be greater than 0 and base not greater than max"))
+	}
+	return errors.Join(errs...)
+}
+
+func getNotifierTypesEnvVariable() []string {
+	value := os.Getenv(notifierTypeEnvVariable)
+	if len(value) != 0 {
+		notifierTypes := []string{}
+		for _, notifierType := range strings.Split(value, ",") {
+			notifierTypes = append(notifierTypes, strings.TrimSpace(notifierType))
+		}
+		return notifierTypes
+	}
+	return []string{notifier.GotifyType}
+}
+
+// getTemplateEnvVariable returns the template set inline in textEnvVariable
+// or, if not set, the content of the file pointed by fileEnvVariable.
+func getTemplateEnvVariable(textEnvVariable string, fileEnvVariable string) (string, error) {
+	if value := os.Getenv(textEnvVariable); len(value) != 0 {
+		return value, nil
+	}
+	if path := os.Getenv(fileEnvVariable); len(path) != 0 {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read template file: %s", err)
+		}
+		return string(content), nil
+	}
+	return "", nil
+}
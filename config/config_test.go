@@ -0,0 +1,337 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("Unexpected error writing configuration file: %s", err)
+	}
+	return path
+}
+
+func Test_load(t *testing.T) {
+	os.Setenv("TEST_GOTIFY_TOKEN", "secret")
+	defer os.Unsetenv("TEST_GOTIFY_TOKEN")
+
+	path := writeConfigFile(t, `
+listen:
+  address: 0.0.0.0
+  port: 9000
+templates:
+  title: '{{ .Labels.alertname }}'
+  files:
+    - /etc/alertmanager-notifier/*.tmpl
+notifiers:
+  - name: desktop
+    type: gotify
+    gotify:
+      url: http://gotify:8080
+      token: ${TEST_GOTIFY_TOKEN}
+  - name: phones
+    type: ntfy
+    ntfy:
+      topic: alerts
+      default_priority: 4
+route:
+  notifier: desktop
+  routes:
+    - matchers: ['instance=~".*:9100$"']
+      notifier: phones
+      continue: true
+receivers:
+  - name: ops
+    notifiers: [desktop, phones]
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+
+	if config.Listen.Address != "0.0.0.0" || config.Listen.Port != "9000" {
+		t.Errorf("Listen configuration was incorrect, got: %+v", config.Listen)
+	}
+	if config.Templates.Title != "{{ .Labels.alertname }}" || len(config.Templates.Files) != 1 {
+		t.Errorf("Templates configuration was incorrect, got: %+v", config.Templates)
+	}
+	if len(config.Notifiers) != 2 {
+		t.Fatalf("Number of notifiers was incorrect want: 2, but got: %d", len(config.Notifiers))
+	}
+	if token := config.Notifiers[0].Gotify.Token; token != "secret" {
+		t.Errorf("Gotify token was incorrect want: secret, but got: %+v", token)
+	}
+	if ntfy := config.Notifiers[1].NTFY; ntfy.Topic != "alerts" || ntfy.DefaultPriority != 4 {
+		t.Errorf("NTFY configuration was incorrect, got: %+v", ntfy)
+	}
+	if matcher := config.Route.Routes[0].Matchers[0]; matcher != `instance=~".*:9100$"` {
+		t.Errorf("Route matcher was incorrect want: %s, but got: %+v", `instance=~".*:9100$"`, matcher)
+	}
+	if !config.Route.Routes[0].Continue || config.Route.Routes[0].Notifier != "phones" {
+		t.Errorf("Route was incorrect, got: %+v", config.Route.Routes[0])
+	}
+	if len(config.Receivers) != 1 || len(config.Receivers[0].Notifiers) != 2 {
+		t.Errorf("Receivers were incorrect, got: %+v", config.Receivers)
+	}
+}
+
+func Test_load_envOverrides(t *testing.T) {
+	os.Setenv(listenPortEnvVariable, "9100")
+	defer os.Unsetenv(listenPortEnvVariable)
+	os.Setenv(titleTemplateEnvVariable, "{{ .Status }}")
+	defer os.Unsetenv(titleTemplateEnvVariable)
+
+	path := writeConfigFile(t, `
+listen:
+  port: 9000
+templates:
+  title: '{{ .Labels.alertname }}'
+  message: '{{ .Annotations.summary }}'
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+
+	if config.Listen.Address != "127.0.0.1" || config.Listen.Port != "9100" {
+		t.Errorf("Listen configuration was incorrect, got: %+v", config.Listen)
+	}
+	if config.Templates.Title != "{{ .Status }}" || config.Templates.Message != "{{ .Annotations.summary }}" {
+		t.Errorf("Templates configuration was incorrect, got: %+v", config.Templates)
+	}
+}
+
+func Test_load_noFile(t *testing.T) {
+	os.Setenv(notifierTypeEnvVariable, "gotify, ntfy")
+	defer os.Unsetenv(notifierTypeEnvVariable)
+
+	config, err := Load("")
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+
+	if len(config.Notifiers) != 2 || config.Notifiers[0].Name != "gotify" || config.Notifiers[1].Type != "ntfy" {
+		t.Errorf("Notifiers were incorrect, got: %+v", config.Notifiers)
+	}
+	if config.Route != nil {
+		t.Errorf("Route should not be set, but got: %+v", config.Route)
+	}
+}
+
+func Test_load_unknownField(t *testing.T) {
+	path := writeConfigFile(t, `
+notifiers:
+  - name: desktop
+    type: gotify
+    gotfy:
+      token: token
+`)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Errorf("Expected an error loading a configuration with unknown fields")
+	}
+}
+
+func Test_load_log(t *testing.T) {
+	os.Setenv(logLevelEnvVariable, "debug")
+	defer os.Unsetenv(logLevelEnvVariable)
+
+	path := writeConfigFile(t, `
+log:
+  level: warn
+  format: json
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+
+	want := LogConfig{Level: "debug", Format: "json"}
+	if config.Log != want {
+		t.Errorf("Log configuration was incorrect want: %+v, but got: %+v", want, config.Log)
+	}
+
+	path = writeConfigFile(t, `
+log:
+  format: logfmt
+`)
+	_, err = Load(path)
+	if err == nil {
+		t.Errorf("Expected an error loading an invalid log format")
+	}
+}
+
+func Test_load_ready(t *testing.T) {
+	config, err := Load("")
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+	want := ReadyConfig{CacheMillis: 10000}
+	if config.Ready != want {
+		t.Errorf("Ready configuration was incorrect want: %+v, but got: %+v", want, config.Ready)
+	}
+
+	os.Setenv(readyCacheMillisEnvVariable, "-1")
+	defer os.Unsetenv(readyCacheMillisEnvVariable)
+	_, err = Load("")
+	if err == nil {
+		t.Errorf("Expected an error loading an invalid ready cache time")
+	}
+}
+
+func Test_load_tracing(t *testing.T) {
+	os.Setenv(tracingEndpointEnvVariable, "http://otel-collector:4318")
+	defer os.Unsetenv(tracingEndpointEnvVariable)
+
+	path := writeConfigFile(t, `
+tracing:
+  endpoint: http://localhost:4318
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+
+	want := TracingConfig{Endpoint: "http://otel-collector:4318", SampleRatio: 1}
+	if config.Tracing != want {
+		t.Errorf("Tracing configuration was incorrect want: %+v, but got: %+v", want, config.Tracing)
+	}
+
+	path = writeConfigFile(t, `
+tracing:
+  sample_ratio: 2
+`)
+	_, err = Load(path)
+	if err == nil {
+		t.Errorf("Expected an error loading an invalid sample ratio")
+	}
+}
+
+func Test_load_queue(t *testing.T) {
+	os.Setenv(queueDirectoryEnvVariable, "/var/lib/alertmanager-notifier")
+	defer os.Unsetenv(queueDirectoryEnvVariable)
+
+	path := writeConfigFile(t, `
+queue:
+  directory: /tmp/queue
+  max_attempts: 5
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+
+	want := QueueConfig{Directory: "/var/lib/alertmanager-notifier", Workers: 1, MaxAttempts: 5, BaseBackoffMillis: 1000, MaxBackoffMillis: 300000}
+	if config.Queue != want {
+		t.Errorf("Queue configuration was incorrect want: %+v, but got: %+v", want, config.Queue)
+	}
+
+	path = writeConfigFile(t, `
+queue:
+  base_backoff_millis: 10000
+  max_backoff_millis: 1000
+`)
+	_, err = Load(path)
+	if err == nil {
+		t.Errorf("Expected an error loading a queue with base backoff greater than max backoff")
+	}
+}
+
+func Test_load_notifierEnvPrecedence(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer fileServer.Close()
+	envServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Notifier should use the url of the file, got a request to the environment one")
+	}))
+	defer envServer.Close()
+	os.Setenv(notifierTypeEnvVariable, "ntfy")
+	defer os.Unsetenv(notifierTypeEnvVariable)
+	os.Setenv("GOTIFY_URL", envServer.URL)
+	defer os.Unsetenv("GOTIFY_URL")
+	os.Setenv("GOTIFY_TOKEN", "env-token")
+	defer os.Unsetenv("GOTIFY_TOKEN")
+
+	path := writeConfigFile(t, `
+notifiers:
+  - name: desktop
+    type: gotify
+    gotify:
+      url: `+fileServer.URL+`
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+	if len(config.Notifiers) != 1 || config.Notifiers[0].Name != "desktop" {
+		t.Fatalf("Notifiers of the file should be used instead of NOTIFIER_TYPE, got: %+v", config.Notifiers)
+	}
+
+	n, err := notifier.New(config.Notifiers[0], alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating notifier: %s", err)
+	}
+	err = n.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	request := <-requests
+	if token := request.Header.Get("X-Gotify-Key"); token != "env-token" {
+		t.Errorf("Token not set in the file should be taken from the environment want: %+v, but got: %+v", "env-token", token)
+	}
+}
+
+func Test_load_receiversWithoutRoute(t *testing.T) {
+	os.Setenv("GOTIFY_TOKEN", "secret")
+	defer os.Unsetenv("GOTIFY_TOKEN")
+
+	path := writeConfigFile(t, `
+notifiers:
+  - name: desktop
+    type: gotify
+    gotify:
+      url: http://gotify
+      token: ${GOTIFY_TOKEN}
+  - name: phones
+    type: ntfy
+    ntfy:
+      topic: alerts
+
+receivers:
+  - name: ops
+    notifiers: [desktop]
+  - name: oncall
+    notifiers: [desktop, phones]
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+	routing, err := notifier.NewRouting(config.Notifiers, config.Route, config.Receivers, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing without route: %s", err)
+	}
+	if routing.Router == nil || len(routing.Receivers) != 2 {
+		t.Errorf("Routing should deliver /alerts to every notifier and have two receivers, got: %+v", routing)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dcasado/alertmanager-notifier/delivery"
+	"github.com/dcasado/alertmanager-notifier/logging"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+	"github.com/dcasado/alertmanager-notifier/tracing"
+)
+
+type deadLettersResponse struct {
+	DeadLetters []*delivery.DeadLetter `json:"deadLetters"`
+}
+
+// replayResponse is the response to a replay, with the result of each dead
+// letter replayed.
+type replayResponse struct {
+	DeadLetters []replayResult `json:"deadLetters"`
+}
+
+type replayResult struct {
+	ID        uint64 `json:"id"`
+	Alertname string `json:"alertname"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+// filterDeadLetters returns the dead letters, only those of the receiver
+// given in the receiver query parameter when it is present.
+func filterDeadLetters(request *http.Request) []*delivery.DeadLetter {
+	letters := deadLetters.List()
+	query := request.URL.Query()
+	if !query.Has("receiver") {
+		return letters
+	}
+
+	filtered := []*delivery.DeadLetter{}
+	for _, letter := range letters {
+		if letter.Receiver == query.Get("receiver") {
+			filtered = append(filtered, letter)
+		}
+	}
+	return filtered
+}
+
+func handleDeadLetters(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(responseWriter).Encode(deadLettersResponse{DeadLetters: filterDeadLetters(request)})
+}
+
+func handleReplayDeadLetter(responseWriter http.ResponseWriter, request *http.Request) {
+	value := request.PathValue("id")
+	id, err := strconv.ParseUint(value, 10, 64)
+	letter, ok := deadLetters.Get(id)
+	if err != nil || !ok {
+		http.Error(responseWriter, fmt.Sprintf("Unknown dead letter %s", value), http.StatusNotFound)
+		return
+	}
+	replayDeadLetters(responseWriter, request, []*delivery.DeadLetter{letter})
+}
+
+func handleReplayDeadLetters(responseWriter http.ResponseWriter, request *http.Request) {
+	replayDeadLetters(responseWriter, request, filterDeadLetters(request))
+}
+
+// replayDeadLetters delivers the dead letters again, or queues them when the
+// queue is enabled. Delivered and queued dead letters are removed from the
+// store, failed ones are kept with the new attempt. Delivered ones are also
+// remembered by the tracker, so a retry of their webhook skips them.
+func replayDeadLetters(responseWriter http.ResponseWriter, request *http.Request, letters []*delivery.DeadLetter) {
+	response := replayResponse{DeadLetters: []replayResult{}}
+	statusCode := http.StatusOK
+	if queue != nil {
+		statusCode = http.StatusAccepted
+	}
+	for _, letter := range letters {
+		result, resultStatusCode := replayDeadLetter(request.Context(), letter)
+		statusCode = aggregateStatusCode(statusCode, resultStatusCode)
+		response.DeadLetters = append(response.DeadLetters, result)
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(response)
+}
+
+func replayDeadLetter(ctx context.Context, letter *delivery.DeadLetter) (replayResult, int) {
+	result := replayResult{ID: letter.ID, Alertname: letter.Data.Labels["alertname"]}
+	logger := slog.With(append(letter.Data.LogAttrs(), logging.ReceiverKey, letter.Receiver, "dead_letter", letter.ID)...)
+	attributes := append(tracing.AlertAttributes(letter.Data.Alert), tracing.ReceiverKey.String(letter.Receiver), tracing.DeadLetterKey.Int64(int64(letter.ID)))
+	ctx, span := tracing.Start(ctx, "dead letter", attributes...)
+
+	if queue != nil {
+		_, err := queue.Enqueue(ctx, letter.Receiver, letter.Data)
+		tracing.End(span, err)
+		if err != nil {
+			logger.Error("Error queueing dead letter", logging.Error(err))
+			result.Result = resultFailed
+			result.Error = http.StatusText(http.StatusInternalServerError)
+			return result, http.StatusInternalServerError
+		}
+		logger.Info("Dead letter queued")
+		removeDeadLetter(logger, letter)
+		result.Result = resultQueued
+		return result, http.StatusAccepted
+	}
+
+	n, ok := receiverNotifier(letter.Receiver)
+	if !ok {
+		err := fmt.Errorf("unknown receiver %s", letter.Receiver)
+		tracing.End(span, err)
+		logger.Warn("Dead letter not replayed, its receiver no longer exists")
+		addDeadLetterAttempt(logger, letter, err)
+		result.Result = resultFailed
+		result.Error = fmt.Sprintf("Unknown receiver %s", letter.Receiver)
+		return result, http.StatusNotFound
+	}
+
+	key := delivery.Key(receiverEndpoint(letter.Receiver), letter.Data.Alert)
+	err := n.Notify(notifier.WithTracking(logging.WithLogger(ctx, logger), tracker, key), letter.Data)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("Dead letter not delivered", logging.Error(err))
+		addDeadLetterAttempt(logger, letter, err)
+		var statusCode int
+		result.Result = resultFailed
+		result.Error, statusCode = failure(err)
+		return result, statusCode
+	}
+	logger.Info("Dead letter delivered")
+	tracker.MarkDelivered(key)
+	removeDeadLetter(logger, letter)
+	result.Result = resultDelivered
+	return result, http.StatusOK
+}
+
+func removeDeadLetter(logger *slog.Logger, letter *delivery.DeadLetter) {
+	err := deadLetters.Remove(letter.ID)
+	if err != nil {
+		logger.Error("Error removing dead letter", logging.Error(err))
+	}
+}
+
+func addDeadLetterAttempt(logger *slog.Logger, letter *delivery.DeadLetter, err error) {
+	err = deadLetters.AddAttempt(letter.ID, delivery.NewAttempt(err))
+	if err != nil {
+		logger.Error("Error storing attempt of dead letter", logging.Error(err))
+	}
+}
@@ -0,0 +1,250 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+const deadLettersFileName = "deadletters.json"
+
+// Attempt is a failed delivery attempt.
+type Attempt struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// NewAttempt returns the attempt failed now with err.
+func NewAttempt(err error) Attempt {
+	return Attempt{Time: time.Now(), Error: err.Error()}
+}
+
+// DeadLetter is the notification of an alert that could not be delivered.
+type DeadLetter struct {
+	ID uint64 `json:"id"`
+	// Receiver is the receiver the alert was received for, empty when it
+	// was received on /alerts.
+	Receiver  string             `json:"receiver"`
+	Data      *alertmanager.Data `json:"data"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Attempts  []Attempt          `json:"attempts"`
+}
+
+// key identifies the alert of the dead letter, so further failures of the
+// same alert are added to it instead of creating a new one.
+func (d *DeadLetter) key() string {
+	return Key(d.Receiver, d.Data.Alert)
+}
+
+// DeadLetters stores the notifications that could not be delivered until
+// they are replayed. When it has a directory, every change is written to a
+// file in it so they survive restarts. The oldest dead letters are dropped
+// when there are more than maxEntries.
+type DeadLetters struct {
+	path       string
+	maxEntries int
+
+	mutex   sync.Mutex
+	nextID  uint64
+	letters []*DeadLetter
+}
+
+// OpenDeadLetters opens the dead letters stored in dir, creating it if it
+// doesn't exist. When dir is empty, the dead letters are only kept in
+// memory.
+func OpenDeadLetters(dir string, maxEntries int) (*DeadLetters, error) {
+	d := &DeadLetters{maxEntries: maxEntries, nextID: 1}
+	if len(dir) == 0 {
+		return d, nil
+	}
+
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dead letters directory: %s", err)
+	}
+	d.path = filepath.Join(dir, deadLettersFileName)
+
+	content, err := os.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read dead letters: %s", err)
+	}
+	err = json.Unmarshal(content, &d.letters)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode dead letters: %s", err)
+	}
+	for _, letter := range d.letters {
+		d.nextID = max(d.nextID, letter.ID+1)
+	}
+	return d, nil
+}
+
+// Add stores the notification of the alert received for receiver with its
+// failed attempts. When the alert is already stored, the attempts are added
+// to the existing dead letter.
+func (d *DeadLetters) Add(receiver string, data *alertmanager.Data, attempts ...Attempt) (*DeadLetter, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	letter := &DeadLetter{Receiver: receiver, Data: data}
+	if existing := d.find(letter.key()); existing != nil {
+		existing.Attempts = append(existing.Attempts, attempts...)
+		return existing.copy(), d.save()
+	}
+
+	letter.ID = d.nextID
+	letter.CreatedAt = time.Now()
+	letter.Attempts = attempts
+	d.nextID++
+	d.letters = append(d.letters, letter)
+	if len(d.letters) > d.maxEntries {
+		dropped := d.letters[0]
+		slog.Warn("Dropping the oldest dead letter, there are too many", append(dropped.Data.LogAttrs(), logging.ReceiverKey, dropped.Receiver, "id", dropped.ID, "max_entries", d.maxEntries)...)
+		d.letters = d.letters[1:]
+	}
+	return letter.copy(), d.save()
+}
+
+// AddAttempt adds a failed attempt to the dead letter with the given id.
+func (d *DeadLetters) AddAttempt(id uint64, attempt Attempt) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, letter := range d.letters {
+		if letter.ID == id {
+			letter.Attempts = append(letter.Attempts, attempt)
+			return d.save()
+		}
+	}
+	return nil
+}
+
+// Resolve removes the dead letter of the alert received for receiver, if
+// any, once it has been delivered.
+func (d *DeadLetters) Resolve(receiver string, alert alertmanager.Alert) error {
+	key := Key(receiver, alert)
+	if len(key) == 0 {
+		return nil
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	letter := d.find(key)
+	if letter == nil {
+		return nil
+	}
+	return d.remove(letter.ID)
+}
+
+// Get returns the dead letter with the given id.
+func (d *DeadLetters) Get(id uint64) (*DeadLetter, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, letter := range d.letters {
+		if letter.ID == id {
+			return letter.copy(), true
+		}
+	}
+	return nil, false
+}
+
+// List returns the dead letters, oldest first.
+func (d *DeadLetters) List() []*DeadLetter {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	letters := make([]*DeadLetter, 0, len(d.letters))
+	for _, letter := range d.letters {
+		letters = append(letters, letter.copy())
+	}
+	return letters
+}
+
+// Len returns the number of dead letters.
+func (d *DeadLetters) Len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return len(d.letters)
+}
+
+// Remove removes the dead letter with the given id.
+func (d *DeadLetters) Remove(id uint64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.remove(id)
+}
+
+// remove must be called with the mutex held.
+func (d *DeadLetters) remove(id uint64) error {
+	for i, letter := range d.letters {
+		if letter.ID == id {
+			d.letters = append(d.letters[:i], d.letters[i+1:]...)
+			return d.save()
+		}
+	}
+	return nil
+}
+
+// find returns the dead letter with the given key. It must be called with
+// the mutex held.
+func (d *DeadLetters) find(key string) *DeadLetter {
+	if len(key) == 0 {
+		return nil
+	}
+	for _, letter := range d.letters {
+		if letter.key() == key {
+			return letter
+		}
+	}
+	return nil
+}
+
+// save writes the dead letters to the file, if any. It must be called with
+// the mutex held.
+func (d *DeadLetters) save() error {
+	if len(d.path) == 0 {
+		return nil
+	}
+
+	content, err := json.Marshal(d.letters)
+	if err != nil {
+		return fmt.Errorf("could not encode dead letters: %s", err)
+	}
+
+	tmpPath := d.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not write dead letters: %s", err)
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("could not write dead letters: %s", err)
+	}
+
+	err = os.Rename(tmpPath, d.path)
+	if err != nil {
+		return fmt.Errorf("could not replace dead letters: %s", err)
+	}
+	return nil
+}
+
+func (d *DeadLetter) copy() *DeadLetter {
+	c := *d
+	c.Attempts = append([]Attempt{}, d.Attempts...)
+	return &c
+}
@@ -0,0 +1,91 @@
+package delivery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_deadLetters(t *testing.T) {
+	dir := t.TempDir()
+	deadLetters, err := OpenDeadLetters(dir, 10)
+	if err != nil {
+		t.Fatalf("Error opening dead letters: %s", err)
+	}
+
+	alert := alertmanager.Alert{Status: "firing", Labels: alertmanager.KV{"alertname": "DiskFull"}, Fingerprint: "c6a7a0a1", StartsAt: time.Now()}
+	data := alertmanager.NewData(alertmanager.RequestBody{}, alert)
+	letter, err := deadLetters.Add("ops", data, NewAttempt(errors.New("first")))
+	if err != nil {
+		t.Fatalf("Error adding dead letter: %s", err)
+	}
+	_, err = deadLetters.Add("ops", data, NewAttempt(errors.New("second")))
+	if err != nil {
+		t.Fatalf("Error adding dead letter: %s", err)
+	}
+	_, err = deadLetters.Add("", data, NewAttempt(errors.New("other receiver")))
+	if err != nil {
+		t.Fatalf("Error adding dead letter: %s", err)
+	}
+	err = deadLetters.AddAttempt(letter.ID, NewAttempt(errors.New("replay")))
+	if err != nil {
+		t.Fatalf("Error adding attempt: %s", err)
+	}
+
+	deadLetters, err = OpenDeadLetters(dir, 10)
+	if err != nil {
+		t.Fatalf("Error reopening dead letters: %s", err)
+	}
+	letters := deadLetters.List()
+	if len(letters) != 2 {
+		t.Fatalf("Number of dead letters was incorrect want: %+v, but got: %+v", 2, len(letters))
+	}
+	got, ok := deadLetters.Get(letter.ID)
+	if !ok {
+		t.Fatalf("Dead letter %d not found", letter.ID)
+	}
+	errs := []string{}
+	for _, attempt := range got.Attempts {
+		errs = append(errs, attempt.Error)
+	}
+	if len(errs) != 3 || errs[0] != "first" || errs[1] != "second" || errs[2] != "replay" {
+		t.Errorf("Attempts were incorrect want: %+v, but got: %+v", []string{"first", "second", "replay"}, errs)
+	}
+
+	err = deadLetters.Resolve("ops", alert)
+	if err != nil {
+		t.Fatalf("Error resolving dead letter: %s", err)
+	}
+	if _, ok := deadLetters.Get(letter.ID); ok {
+		t.Errorf("Dead letter should be removed once resolved")
+	}
+
+	letter, err = deadLetters.Add("ops", data)
+	if err != nil {
+		t.Fatalf("Error adding dead letter: %s", err)
+	}
+	if letter.ID != 3 {
+		t.Errorf("ID was incorrect want: %+v, but got: %+v", 3, letter.ID)
+	}
+}
+
+func Test_deadLetters_maxEntries(t *testing.T) {
+	deadLetters, err := OpenDeadLetters("", 2)
+	if err != nil {
+		t.Fatalf("Error opening dead letters: %s", err)
+	}
+
+	for _, alertname := range []string{"first", "second", "third"} {
+		_, err := deadLetters.Add("", testData(alertname))
+		if err != nil {
+			t.Fatalf("Error adding dead letter: %s", err)
+		}
+	}
+
+	letters := deadLetters.List()
+	if len(letters) != 2 || letters[0].Data.Labels["alertname"] != "second" {
+		t.Errorf("Dead letters were incorrect, got: %+v", letters)
+	}
+}
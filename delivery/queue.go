@@ -0,0 +1,333 @@
+package delivery
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/tracing"
+)
+
+const journalFileName = "queue.log"
+
+// compactThreshold is the number of done records the journal holds before it
+// is compacted, unless there are more pending entries, so it doesn't grow
+// without bound while the queue is never empty.
+const compactThreshold = 1000
+
+const (
+	opAdd  = "add"
+	opDone = "done"
+)
+
+// Entry is the notification of an alert waiting to be delivered.
+type Entry struct {
+	ID uint64 `json:"id"`
+	// Receiver is the receiver the alert was received for, empty when it
+	// was received on /alerts.
+	Receiver   string             `json:"receiver,omitempty"`
+	Data       *alertmanager.Data `json:"data"`
+	EnqueuedAt time.Time          `json:"enqueuedAt"`
+	// TraceContext is the trace context of the request the alert was
+	// received in, so its delivery is linked to it.
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+	// Attempts is the number of failed delivery attempts. It is not
+	// persisted, so it starts again from 0 after a restart.
+	Attempts int `json:"-"`
+
+	// history holds the failed attempts. Like Attempts, it is not
+	// persisted.
+	history []Attempt
+
+	notBefore time.Time
+	inFlight  bool
+}
+
+type record struct {
+	Op    string `json:"op"`
+	ID    uint64 `json:"id"`
+	Entry *Entry `json:"entry,omitempty"`
+}
+
+// Queue is a durable FIFO queue of notifications. Every change is appended
+// to a journal file, synced to disk before returning, which is replayed when
+// the queue is opened so pending notifications survive restarts.
+type Queue struct {
+	path string
+
+	mutex   sync.Mutex
+	journal *os.File
+	nextID  uint64
+	pending []*Entry
+	// done is the number of done records written to the journal since it
+	// was last compacted.
+	done             int
+	compactThreshold int
+	// changed is closed and replaced every time an entry becomes available.
+	changed chan struct{}
+}
+
+// OpenQueue opens the queue stored in dir, creating it if it doesn't exist.
+func OpenQueue(dir string) (*Queue, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create queue directory: %s", err)
+	}
+
+	q := &Queue{path: filepath.Join(dir, journalFileName), nextID: 1, compactThreshold: compactThreshold, changed: make(chan struct{})}
+	err = q.replay()
+	if err != nil {
+		return nil, err
+	}
+	err = q.compact()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) replay() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open queue journal: %s", err)
+	}
+	defer file.Close()
+
+	entries := map[uint64]*Entry{}
+	order := []uint64{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			// A record partially written before a crash can only be the
+			// last one, so the rest of the journal is valid.
+			break
+		}
+		switch r.Op {
+		case opAdd:
+			if r.Entry != nil {
+				entries[r.ID] = r.Entry
+				order = append(order, r.ID)
+			}
+		case opDone:
+			delete(entries, r.ID)
+		}
+		q.nextID = max(q.nextID, r.ID+1)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read queue journal: %s", err)
+	}
+
+	for _, id := range order {
+		if entry, ok := entries[id]; ok {
+			q.pending = append(q.pending, entry)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the journal with only the pending entries. It must be
+// called with the mutex held or before the queue is used.
+func (q *Queue) compact() error {
+	tmpPath := q.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not create queue journal: %s", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range q.pending {
+		err = encoder.Encode(record{Op: opAdd, ID: entry.ID, Entry: entry})
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("could not write queue journal: %s", err)
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("could not write queue journal: %s", err)
+	}
+
+	err = os.Rename(tmpPath, q.path)
+	if err != nil {
+		return fmt.Errorf("could not replace queue journal: %s", err)
+	}
+
+	if q.journal != nil {
+		q.journal.Close()
+	}
+	q.journal, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open queue journal: %s", err)
+	}
+	q.done = 0
+	return nil
+}
+
+// append writes the records to the journal and syncs it. It must be called
+// with the mutex held.
+func (q *Queue) append(records ...record) error {
+	var buffer []byte
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("could not encode queue record: %s", err)
+		}
+		buffer = append(buffer, line...)
+		buffer = append(buffer, '\n')
+	}
+
+	_, err := q.journal.Write(buffer)
+	if err == nil {
+		err = q.journal.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("could not write queue journal: %s", err)
+	}
+	return nil
+}
+
+// Enqueue persists the notifications of the given receiver. When it returns
+// without error, the notifications will be delivered even if the process
+// restarts.
+func (q *Queue) Enqueue(ctx context.Context, receiver string, data ...*alertmanager.Data) ([]*Entry, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	traceContext := tracing.Inject(ctx)
+	entries := make([]*Entry, 0, len(data))
+	records := make([]record, 0, len(data))
+	for i, d := range data {
+		entry := &Entry{ID: q.nextID + uint64(i), Receiver: receiver, Data: d, EnqueuedAt: now, TraceContext: traceContext}
+		entries = append(entries, entry)
+		records = append(records, record{Op: opAdd, ID: entry.ID, Entry: entry})
+	}
+
+	err := q.append(records...)
+	if err != nil {
+		return nil, err
+	}
+	q.nextID += uint64(len(data))
+	q.pending = append(q.pending, entries...)
+	q.notify()
+	return entries, nil
+}
+
+// Next returns the oldest entry ready to be delivered, waiting for one if
+// there are none. The entry is not returned again until it is released with
+// Done or Retry.
+func (q *Queue) Next(ctx context.Context) (*Entry, error) {
+	for {
+		q.mutex.Lock()
+		now := time.Now()
+		var earliest time.Time
+		for _, entry := range q.pending {
+			if entry.inFlight {
+				continue
+			}
+			if !entry.notBefore.After(now) {
+				entry.inFlight = true
+				q.mutex.Unlock()
+				return entry, nil
+			}
+			if earliest.IsZero() || entry.notBefore.Before(earliest) {
+				earliest = entry.notBefore
+			}
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+
+		var timer *time.Timer
+		var ready <-chan time.Time
+		if !earliest.IsZero() {
+			timer = time.NewTimer(time.Until(earliest))
+			ready = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-ready:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Done removes the entry from the queue. The journal is compacted when the
+// queue is empty, or when it holds more done records than the threshold and
+// the pending entries, so rewriting it costs less than the space it frees.
+func (q *Queue) Done(entry *Entry) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, e := range q.pending {
+		if e.ID == entry.ID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+
+	if len(q.pending) == 0 || q.done+1 >= max(q.compactThreshold, len(q.pending)) {
+		return q.compact()
+	}
+	err := q.append(record{Op: opDone, ID: entry.ID})
+	if err != nil {
+		return err
+	}
+	q.done++
+	return nil
+}
+
+// Retry releases the entry to be delivered again after delay.
+func (q *Queue) Retry(entry *Entry, delay time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	entry.Attempts++
+	entry.notBefore = time.Now().Add(delay)
+	entry.inFlight = false
+	q.notify()
+}
+
+// Len returns the number of entries in the queue.
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending)
+}
+
+// Close closes the journal.
+func (q *Queue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.journal.Close()
+}
+
+// notify wakes up the callers waiting in Next. It must be called with the
+// mutex held.
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
@@ -0,0 +1,335 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testData(alertname string) *alertmanager.Data {
+	alert := alertmanager.Alert{Status: "firing", Labels: alertmanager.KV{"alertname": alertname}}
+	return alertmanager.NewData(alertmanager.RequestBody{}, alert)
+}
+
+func Test_queue_survivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+
+	entries, err := q.Enqueue(context.Background(), "ops", testData("first"), testData("second"), testData("third"))
+	if err != nil {
+		t.Fatalf("Error enqueueing: %s", err)
+	}
+	err = q.Done(entries[1])
+	if err != nil {
+		t.Fatalf("Error removing entry: %s", err)
+	}
+	q.Close()
+
+	q, err = OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error reopening queue: %s", err)
+	}
+	defer q.Close()
+
+	if q.Len() != 2 {
+		t.Fatalf("Queue length was incorrect want: %+v, but got: %+v", 2, q.Len())
+	}
+	for _, want := range []string{"first", "third"} {
+		entry, err := q.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Error getting next entry: %s", err)
+		}
+		if entry.Receiver != "ops" {
+			t.Errorf("Receiver was incorrect want: %+v, but got: %+v", "ops", entry.Receiver)
+		}
+		if got := entry.Data.Labels["alertname"]; got != want {
+			t.Errorf("Alertname was incorrect want: %+v, but got: %+v", want, got)
+		}
+	}
+
+	entries, err = q.Enqueue(context.Background(), "", testData("fourth"))
+	if err != nil {
+		t.Fatalf("Error enqueueing: %s", err)
+	}
+	if entries[0].ID != 4 {
+		t.Errorf("ID was incorrect want: %+v, but got: %+v", 4, entries[0].ID)
+	}
+}
+
+func Test_queue_traceContext(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}))
+	_, err = q.Enqueue(ctx, "ops", testData("traced"))
+	if err != nil {
+		t.Fatalf("Error enqueueing: %s", err)
+	}
+	q.Close()
+
+	q, err = OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error reopening queue: %s", err)
+	}
+	defer q.Close()
+
+	entry, err := q.Next(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting next entry: %s", err)
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := entry.TraceContext["traceparent"]; got != want {
+		t.Errorf("Trace context was incorrect want: %+v, but got: %+v", want, got)
+	}
+}
+
+func Test_queue_partialRecord(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+	_, err = q.Enqueue(context.Background(), "", testData("first"))
+	if err != nil {
+		t.Fatalf("Error enqueueing: %s", err)
+	}
+	q.Close()
+
+	journal, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	journal.WriteString(`{"op":"add","id":2,"entry":{"id":2,`)
+	journal.Close()
+
+	q, err = OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error reopening queue: %s", err)
+	}
+	defer q.Close()
+	if q.Len() != 1 {
+		t.Errorf("Queue length was incorrect want: %+v, but got: %+v", 1, q.Len())
+	}
+}
+
+func Test_queue_compactsDoneRecords(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+	q.compactThreshold = 2
+	_, err = q.Enqueue(context.Background(), "", testData("first"), testData("second"), testData("third"), testData("fourth"))
+	if err != nil {
+		t.Fatalf("Error enqueueing: %s", err)
+	}
+
+	journalLines := func() int {
+		content, err := os.ReadFile(filepath.Join(dir, journalFileName))
+		if err != nil {
+			t.Fatalf("Error reading journal: %s", err)
+		}
+		return strings.Count(string(content), "\n")
+	}
+	wantLines := []int{5, 2}
+	for i, want := range wantLines {
+		entry, err := q.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Error getting next entry: %s", err)
+		}
+		err = q.Done(entry)
+		if err != nil {
+			t.Fatalf("Error removing entry: %s", err)
+		}
+		if lines := journalLines(); lines != want {
+			t.Errorf("Journal lines after %d done were incorrect want: %+v, but got: %+v", i+1, want, lines)
+		}
+	}
+	q.Close()
+
+	q, err = OpenQueue(dir)
+	if err != nil {
+		t.Fatalf("Error reopening queue: %s", err)
+	}
+	defer q.Close()
+	entry, _ := q.Next(context.Background())
+	if q.Len() != 2 || entry.Data.Labels["alertname"] != "third" {
+		t.Errorf("Queue should keep the pending entries in order, got length %d and first %+v", q.Len(), entry.Data.Labels["alertname"])
+	}
+}
+
+func Test_queue_next(t *testing.T) {
+	q, err := OpenQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+	defer q.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Enqueue(context.Background(), "", testData("first"))
+	}()
+	entry, err := q.Next(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting next entry: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = q.Next(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Next should wait while the entry is in flight, but got: %v", err)
+	}
+
+	start := time.Now()
+	q.Retry(entry, 30*time.Millisecond)
+	entry, err = q.Next(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting next entry: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Retried entry returned before its delay, after %s", elapsed)
+	}
+	if entry.Attempts != 1 {
+		t.Errorf("Attempts was incorrect want: %+v, but got: %+v", 1, entry.Attempts)
+	}
+}
+
+// fakeNotifier returns the errors in order, one per call, and nil once they
+// are exhausted.
+type fakeNotifier struct {
+	errs  []error
+	calls chan *alertmanager.Data
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	f.calls <- data
+	if len(f.errs) != 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func Test_workers(t *testing.T) {
+	q, err := OpenQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+	defer q.Close()
+
+	n := &fakeNotifier{errs: []error{notifier.NewErrHTTPError(503, "Service Unavailable")}, calls: make(chan *alertmanager.Data, 10)}
+	notifiers := func(receiver string) (notifier.Notifier, bool) {
+		return n, receiver == "ops"
+	}
+
+	deadLetters, err := OpenDeadLetters("", 10)
+	if err != nil {
+		t.Fatalf("Error opening dead letters: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := StartWorkers(ctx, q, notifiers, deadLetters, WorkerConfig{Workers: 1, MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	q.Enqueue(context.Background(), "unknown", testData("dropped"))
+	q.Enqueue(context.Background(), "ops", testData("retried"))
+
+	for range 2 {
+		select {
+		case data := <-n.calls:
+			if got := data.Labels["alertname"]; got != "retried" {
+				t.Errorf("Alertname was incorrect want: %+v, but got: %+v", "retried", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Alert was not delivered")
+		}
+	}
+
+	cancel()
+	wg.Wait()
+	if q.Len() != 0 {
+		t.Errorf("Queue length was incorrect want: %+v, but got: %+v", 0, q.Len())
+	}
+	letters := deadLetters.List()
+	if len(letters) != 1 || letters[0].Receiver != "unknown" || len(letters[0].Attempts) != 1 {
+		t.Errorf("Dead letters were incorrect, got: %+v", letters)
+	}
+}
+
+func Test_workers_deadLetter(t *testing.T) {
+	q, err := OpenQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening queue: %s", err)
+	}
+	defer q.Close()
+	deadLetters, err := OpenDeadLetters("", 10)
+	if err != nil {
+		t.Fatalf("Error opening dead letters: %s", err)
+	}
+
+	errs := []error{notifier.NewErrNotAvailable("http://gotify", "timeout"), notifier.NewErrHTTPError(503, "Service Unavailable")}
+	n := &fakeNotifier{errs: errs, calls: make(chan *alertmanager.Data, 10)}
+	notifiers := func(receiver string) (notifier.Notifier, bool) {
+		return n, true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := StartWorkers(ctx, q, notifiers, deadLetters, WorkerConfig{Workers: 1, MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	q.Enqueue(context.Background(), "ops", testData("failed"))
+
+	deadline := time.Now().Add(time.Second)
+	for len(deadLetters.List()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	letters := deadLetters.List()
+	if len(letters) != 1 {
+		t.Fatalf("Number of dead letters was incorrect want: %+v, but got: %+v", 1, len(letters))
+	}
+	for i, attempt := range letters[0].Attempts {
+		if attempt.Error != errs[i].Error() {
+			t.Errorf("Attempt %d error was incorrect want: %+v, but got: %+v", i, errs[i].Error(), attempt.Error)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Queue length was incorrect want: %+v, but got: %+v", 0, q.Len())
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, time.Minute},
+		{1000, time.Minute},
+	}
+	for _, test := range tests {
+		got := backoff(test.attempt, time.Second, time.Minute)
+		if got != test.want {
+			t.Errorf("Backoff of attempt %d was incorrect want: %+v, but got: %+v", test.attempt, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package delivery
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+// Tracker remembers the alerts already delivered, so the alerts of a webhook
+// retried by Alertmanager that were delivered the first time are not
+// delivered again. Deliveries are forgotten after the ttl, which should be
+// shorter than the Alertmanager repeat interval so repeated notifications
+// are still delivered.
+type Tracker struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mutex     sync.Mutex
+	delivered map[string]time.Time
+}
+
+// NewTracker returns a tracker remembering the deliveries during ttl.
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{ttl: ttl, now: time.Now, delivered: map[string]time.Time{}}
+}
+
+// Key returns the key identifying the delivery of the alert on the given
+// endpoint. It includes the start time of the alert so an alert firing again
+// after being resolved is not mistaken for the previous one. Alerts without
+// fingerprint can't be identified and have an empty key.
+func Key(endpoint string, alert alertmanager.Alert) string {
+	if len(alert.Fingerprint) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s|%s|%s|%s", endpoint, alert.Fingerprint, alert.Status, alert.StartsAt.Format(time.RFC3339Nano))
+}
+
+// Delivered returns whether the delivery with the given key was already
+// done.
+func (t *Tracker) Delivered(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	deliveredAt, ok := t.delivered[key]
+	return ok && t.now().Sub(deliveredAt) < t.ttl
+}
+
+// MarkDelivered records the delivery with the given key and forgets the
+// expired ones.
+func (t *Tracker) MarkDelivered(key string) {
+	if len(key) == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	for k, deliveredAt := range t.delivered {
+		if now.Sub(deliveredAt) >= t.ttl {
+			delete(t.delivered, k)
+		}
+	}
+	t.delivered[key] = now
+}
@@ -0,0 +1,54 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_tracker(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tracker := NewTracker(time.Hour)
+	tracker.now = func() time.Time { return now }
+
+	alert := alertmanager.Alert{Status: "firing", Fingerprint: "c6a7a0a1", StartsAt: now}
+	key := Key("/alerts", alert)
+
+	if tracker.Delivered(key) {
+		t.Errorf("Alert should not be delivered before marking it")
+	}
+
+	tracker.MarkDelivered(key)
+	if !tracker.Delivered(key) {
+		t.Errorf("Alert should be delivered after marking it")
+	}
+
+	alert.Status = "resolved"
+	if tracker.Delivered(Key("/alerts", alert)) {
+		t.Errorf("Resolved alert should not be delivered when only the firing one was")
+	}
+	if tracker.Delivered(Key("/alerts/ops", alert)) {
+		t.Errorf("Alert should not be delivered on a different endpoint")
+	}
+
+	now = now.Add(time.Hour)
+	if tracker.Delivered(key) {
+		t.Errorf("Delivery should be forgotten after the ttl")
+	}
+	tracker.MarkDelivered(Key("/alerts", alert))
+	if len(tracker.delivered) != 1 {
+		t.Errorf("Expired deliveries should be removed, but got: %+v", tracker.delivered)
+	}
+}
+
+func Test_tracker_noFingerprint(t *testing.T) {
+	tracker := NewTracker(time.Hour)
+
+	key := Key("/alerts", alertmanager.Alert{Status: "firing"})
+	tracker.MarkDelivered(key)
+
+	if tracker.Delivered(key) {
+		t.Errorf("Alerts without fingerprint should never be considered delivered")
+	}
+}
@@ -0,0 +1,127 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/logging"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+	"github.com/dcasado/alertmanager-notifier/tracing"
+)
+
+// WorkerConfig configures the workers delivering the queued notifications.
+type WorkerConfig struct {
+	Workers int
+	// MaxAttempts is the maximum number of delivery attempts of a
+	// notification before it is moved to the dead letters.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Tracker remembers the destinations each notification was delivered
+	// to, so its retries skip them. Nil disables tracking.
+	Tracker *Tracker
+}
+
+// NotifierFunc returns the notifier of the given receiver, or the notifier
+// of the /alerts endpoint when receiver is empty.
+type NotifierFunc func(receiver string) (notifier.Notifier, bool)
+
+// StartWorkers starts the workers delivering the notifications of the queue
+// with the notifiers returned by notifiers until ctx is done. Failed
+// deliveries are retried with an exponential backoff and moved to
+// deadLetters once the attempts are exhausted. The returned wait group is
+// done once all the workers have stopped.
+func StartWorkers(ctx context.Context, q *Queue, notifiers NotifierFunc, deadLetters *DeadLetters, config WorkerConfig) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				entry, err := q.Next(ctx)
+				if err != nil {
+					return
+				}
+				deliver(ctx, q, entry, notifiers, deadLetters, config)
+			}
+		}()
+	}
+	return &wg
+}
+
+func deliver(ctx context.Context, q *Queue, entry *Entry, notifiers NotifierFunc, deadLetters *DeadLetters, config WorkerConfig) {
+	logger := slog.With(append(entry.Data.LogAttrs(), logging.ReceiverKey, entry.Receiver)...)
+	attributes := append(tracing.AlertAttributes(entry.Data.Alert), tracing.ReceiverKey.String(entry.Receiver), tracing.AttemptKey.Int(entry.Attempts+1))
+	ctx, span := tracing.StartLinked(ctx, "queued alert", entry.TraceContext, attributes...)
+
+	n, ok := notifiers(entry.Receiver)
+	if !ok {
+		err := fmt.Errorf("unknown receiver %s", entry.Receiver)
+		tracing.End(span, err)
+		logger.Error("Moving queued alert to the dead letters, its receiver no longer exists")
+		entry.history = append(entry.history, NewAttempt(err))
+		deadLetter(logger, q, entry, deadLetters)
+		return
+	}
+
+	ctx = logging.WithLogger(ctx, logger)
+	if config.Tracker != nil {
+		ctx = notifier.WithTracking(ctx, config.Tracker, fmt.Sprintf("queue|%d", entry.ID))
+	}
+	err := n.Notify(ctx, entry.Data)
+	tracing.End(span, err)
+	if err == nil {
+		logger.Info("Queued alert delivered")
+		err = deadLetters.Resolve(entry.Receiver, entry.Data.Alert)
+		if err != nil {
+			logger.Error("Error removing alert from the dead letters", logging.Error(err))
+		}
+		done(logger, q, entry)
+		return
+	}
+	if ctx.Err() != nil {
+		// The entry is kept in the journal and delivered after a restart.
+		return
+	}
+	entry.history = append(entry.history, NewAttempt(err))
+
+	attempt := entry.Attempts + 1
+	if attempt >= config.MaxAttempts {
+		logger.Error("Moving queued alert to the dead letters, attempts exhausted", logging.AttemptKey, attempt, logging.Error(err))
+		deadLetter(logger, q, entry, deadLetters)
+		return
+	}
+
+	delay := backoff(attempt, config.BaseBackoff, config.MaxBackoff)
+	logger.Warn("Queued alert delivery failed, retrying", logging.AttemptKey, attempt, "max_attempts", config.MaxAttempts, "delay", delay, logging.Error(err))
+	q.Retry(entry, delay)
+}
+
+// deadLetter moves the entry to the dead letters.
+func deadLetter(logger *slog.Logger, q *Queue, entry *Entry, deadLetters *DeadLetters) {
+	_, err := deadLetters.Add(entry.Receiver, entry.Data, entry.history...)
+	if err != nil {
+		logger.Error("Error storing alert in the dead letters", logging.Error(err))
+	}
+	done(logger, q, entry)
+}
+
+func done(logger *slog.Logger, q *Queue, entry *Entry) {
+	err := q.Done(entry)
+	if err != nil {
+		logger.Error("Error removing alert from the queue", logging.Error(err))
+	}
+}
+
+// backoff returns the delay before the retry following the given attempt,
+// doubling base on each attempt up to maxBackoff.
+func backoff(attempt int, base time.Duration, maxBackoff time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys shared by all the log lines, so the lines of an alert can be
+// correlated.
+const (
+	AlertnameKey   = "alertname"
+	FingerprintKey = "fingerprint"
+	StatusKey      = "status"
+	NotifierKey    = "notifier"
+	ReceiverKey    = "receiver"
+	AttemptKey     = "attempt"
+	ErrorKey       = "error"
+)
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// Level is the level of the default logger. It can be changed while the
+// service runs.
+var Level = new(slog.LevelVar)
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid log level %q, must be one of debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// ValidateFormat returns an error if format is not a valid log format.
+func ValidateFormat(format string) error {
+	if format != TextFormat && format != JSONFormat {
+		return fmt.Errorf("invalid log format %q, must be one of %s", format, strings.Join([]string{TextFormat, JSONFormat}, ", "))
+	}
+	return nil
+}
+
+// New returns a logger writing to w in the given format, text or json, with
+// the lines of level Level or higher.
+func New(w io.Writer, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: Level}
+	if format == JSONFormat {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// Error returns the attribute of an error.
+func Error(err error) slog.Attr {
+	return slog.String(ErrorKey, err.Error())
+}
+
+type contextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger, so the functions it is
+// passed to log with its attributes.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger if it
+// carries none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
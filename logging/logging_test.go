@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func Test_ParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for value, want := range tests {
+		level, err := ParseLevel(value)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing level %s: %s", value, err)
+		}
+		if level != want {
+			t.Errorf("Level was incorrect want: %s, but got: %s", want, level)
+		}
+	}
+
+	_, err := ParseLevel("verbose")
+	if err == nil {
+		t.Errorf("Expected an error parsing an invalid level")
+	}
+}
+
+func Test_ValidateFormat(t *testing.T) {
+	for _, format := range []string{TextFormat, JSONFormat} {
+		if err := ValidateFormat(format); err != nil {
+			t.Errorf("Unexpected error validating format %s: %s", format, err)
+		}
+	}
+	if err := ValidateFormat("logfmt"); err == nil {
+		t.Errorf("Expected an error validating an invalid format")
+	}
+}
+
+func Test_New(t *testing.T) {
+	defer Level.Set(slog.LevelInfo)
+	Level.Set(slog.LevelWarn)
+
+	var buffer bytes.Buffer
+	logger := New(&buffer, JSONFormat).With(ReceiverKey, "team-a")
+	logger.Info("Not written")
+	logger.Warn("Alert not delivered", NotifierKey, "gotify", Error(errors.New("connection refused")))
+
+	line := map[string]any{}
+	err := json.Unmarshal(buffer.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding log line %q: %s", buffer.String(), err)
+	}
+	want := map[string]string{"msg": "Alert not delivered", ReceiverKey: "team-a", NotifierKey: "gotify", ErrorKey: "connection refused"}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("Attribute %s was incorrect want: %s, but got: %v", key, value, line[key])
+		}
+	}
+}
+
+func Test_FromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Errorf("Expected the default logger from a context without logger")
+	}
+
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	ctx := WithLogger(context.Background(), logger)
+	if FromContext(ctx) != logger {
+		t.Errorf("Expected the logger carried by the context")
+	}
+}
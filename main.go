@@ -1,100 +1,393 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/config"
+	"github.com/dcasado/alertmanager-notifier/delivery"
+	"github.com/dcasado/alertmanager-notifier/logging"
+	"github.com/dcasado/alertmanager-notifier/metrics"
 	"github.com/dcasado/alertmanager-notifier/notifier"
+	"github.com/dcasado/alertmanager-notifier/tracing"
 )
 
-const (
-	listenAddressEnvVariable = "LISTEN_ADDRESS"
-	listenPortEnvVariable    = "LISTEN_PORT"
-	notifierTypeEnvVariable  = "NOTIFIER_TYPE"
-)
+// shutdownTimeout is the time the server waits for the requests being handled
+// to answer after cancelling their deliveries on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// routing holds the active notifiers. It is swapped when the configuration
+// is reloaded.
+var routing atomic.Pointer[notifier.Routing]
 
-var s notifier.Notifier
+// tracker remembers the delivered alerts to skip them when alertmanager
+// retries a webhook.
+var tracker *delivery.Tracker
+
+// deadLetters holds the alerts that could not be delivered until they are
+// replayed.
+var deadLetters *delivery.DeadLetters
+
+// queue holds the alerts waiting to be delivered. It is nil unless the
+// queue is enabled, in which case alerts are delivered asynchronously.
+var queue *delivery.Queue
 
 func main() {
-	listenAddress := getListenAddressEnvVariable()
-	listenPort := getListenPortEnvVariable()
-	notifierType := getNotifierTypeEnvVariable()
+	configFile := flag.String("config", "", "Path to the YAML configuration file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fatal("Error loading configuration", err)
+	}
+	setupLogging(cfg.Log)
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if len(cfg.Tracing.Endpoint) != 0 {
+		shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing.Endpoint, cfg.Tracing.SampleRatio)
+		if err != nil {
+			fatal("Error setting up tracing", err)
+		}
+		slog.Info("Tracing enabled", "endpoint", cfg.Tracing.Endpoint, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
+	r, err := newRouting(cfg)
+	if err != nil {
+		fatal("Error loading configuration", err)
+	}
+	routing.Store(r)
+	readiness.Store(newReadiness(r, cfg))
+	tracker = delivery.NewTracker(time.Duration(cfg.Delivery.TrackingTTLMillis) * time.Millisecond)
+	deadLetters, err = delivery.OpenDeadLetters(cfg.DeadLetters.Directory, cfg.DeadLetters.MaxEntries)
+	if err != nil {
+		fatal("Error opening the dead letters", err)
+	}
+	metrics.RegisterDeadLetters(deadLetters.Len)
+	metrics.RegisterCircuitBreakers(breakerStates, circuitBreakers)
 
-	s = notifier.New(notifierType)
+	watchReloadSignal(*configFile, cfg)
 
-	log.Printf("Starting server listening on %s:%s", listenAddress, listenPort)
+	slog.Info("Starting server", "address", cfg.Listen.Address, "port", cfg.Listen.Port)
 
 	serveMux := http.NewServeMux()
-	serveMux.HandleFunc("POST /alerts", handleAlerts)
+	serveMux.Handle("POST /alerts", tracing.Handler("POST /alerts", handleAlerts))
+	serveMux.Handle("POST /alerts/{receiver}", tracing.Handler("POST /alerts/{receiver}", handleReceiverAlerts))
 	serveMux.HandleFunc("GET /health", handleHealth)
+	serveMux.HandleFunc("GET /ready", handleReady)
+	serveMux.Handle("GET /metrics", metrics.Handler())
+	serveMux.HandleFunc("POST /-/reload", reloadHandler(*configFile, cfg))
+	serveMux.HandleFunc("GET /api/deadletters", handleDeadLetters)
+	serveMux.Handle("POST /api/deadletters/replay", tracing.Handler("POST /api/deadletters/replay", handleReplayDeadLetters))
+	serveMux.Handle("POST /api/deadletters/{id}/replay", tracing.Handler("POST /api/deadletters/{id}/replay", handleReplayDeadLetter))
 
+	// Requests contexts and queue workers derive from baseContext, so
+	// cancelling it cancels the in-flight deliveries.
+	baseContext, cancelBaseContext := context.WithCancel(context.Background())
+
+	var workers *sync.WaitGroup
+	if len(cfg.Queue.Directory) != 0 {
+		queue, err = delivery.OpenQueue(cfg.Queue.Directory)
+		if err != nil {
+			fatal("Error opening the queue", err)
+		}
+		slog.Info("Queue enabled", "directory", cfg.Queue.Directory, "pending", queue.Len())
+		metrics.RegisterQueueLength(queue.Len)
+		workers = delivery.StartWorkers(baseContext, queue, receiverNotifier, deadLetters, delivery.WorkerConfig{
+			Workers:     cfg.Queue.Workers,
+			MaxAttempts: cfg.Queue.MaxAttempts,
+			BaseBackoff: time.Duration(cfg.Queue.BaseBackoffMillis) * time.Millisecond,
+			MaxBackoff:  time.Duration(cfg.Queue.MaxBackoffMillis) * time.Millisecond,
+			Tracker:     tracker,
+		})
+	}
 	server := &http.Server{
-		Addr:    fmt.Sprintf("%s:%s", listenAddress, listenPort),
-		Handler: serveMux,
+		Addr:        fmt.Sprintf("%s:%s", cfg.Listen.Address, cfg.Listen.Port),
+		Handler:     serveMux,
+		BaseContext: func(net.Listener) context.Context { return baseContext },
 	}
 
-	err := server.ListenAndServe()
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Error starting the server", err)
+		}
+	}()
+
+	shutdownSignals := make(chan os.Signal, 1)
+	signal.Notify(shutdownSignals, syscall.SIGINT, syscall.SIGTERM)
+	<-shutdownSignals
+
+	slog.Info("Shutting down the server")
+	cancelBaseContext()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		slog.Error("Error shutting down the server", logging.Error(err))
+	}
+	if queue != nil {
+		workers.Wait()
+		queue.Close()
+	}
+	err = shutdownTracing(ctx)
 	if err != nil {
-		log.Fatalf("Error starting the server: %s", err)
+		slog.Error("Error flushing the traces", logging.Error(err))
 	}
 }
 
-func getListenAddressEnvVariable() string {
-	value := os.Getenv(listenAddressEnvVariable)
-	if len(value) != 0 {
-		return value
-	}
-	return "127.0.0.1"
+// setupLogging sets the default logger with the format and level of the
+// configuration. Lines written with the log package go through it too.
+func setupLogging(cfg config.LogConfig) {
+	level, _ := logging.ParseLevel(cfg.Level)
+	logging.Level.Set(level)
+	slog.SetDefault(logging.New(os.Stderr, cfg.Format))
 }
 
-func getListenPortEnvVariable() string {
-	value := os.Getenv(listenPortEnvVariable)
-	if len(value) != 0 {
-		return value
-	}
-	return "8080"
+// fatal logs the error and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Error(err))
+	os.Exit(1)
+}
+
+const (
+	resultDelivered = "delivered"
+	resultSkipped   = "skipped"
+	resultFailed    = "failed"
+	resultQueued    = "queued"
+)
+
+// alertsResponse is the response to the alerts received from alertmanager,
+// with the delivery result of each of them.
+type alertsResponse struct {
+	Alerts []alertResult `json:"alerts"`
+}
+
+type alertResult struct {
+	Fingerprint string `json:"fingerprint"`
+	Alertname   string `json:"alertname"`
+	Status      string `json:"status"`
+	Result      string `json:"result"`
+	Error       string `json:"error,omitempty"`
 }
 
-func getNotifierTypeEnvVariable() string {
-	value := os.Getenv(notifierTypeEnvVariable)
-	if len(value) != 0 {
-		return value
+// receiverNotifier returns the active notifier of the receiver, or the one
+// of the /alerts endpoint when receiver is empty.
+func receiverNotifier(receiver string) (notifier.Notifier, bool) {
+	r := routing.Load()
+	if len(receiver) == 0 {
+		return r.Router, true
 	}
-	return notifier.GotifyType
+	n, ok := r.Receivers[receiver]
+	return n, ok
 }
 
 func handleAlerts(responseWriter http.ResponseWriter, request *http.Request) {
+	handleReceiver(responseWriter, request, "")
+}
+
+func handleReceiverAlerts(responseWriter http.ResponseWriter, request *http.Request) {
+	handleReceiver(responseWriter, request, request.PathValue("receiver"))
+}
+
+func handleReceiver(responseWriter http.ResponseWriter, request *http.Request, receiver string) {
+	logger := slog.With(logging.ReceiverKey, receiver)
+	tracing.SetAttributes(request.Context(), tracing.ReceiverKey.String(receiver))
+
+	n, ok := receiverNotifier(receiver)
+	if !ok {
+		logger.Warn("Request received for unknown receiver")
+		http.Error(responseWriter, fmt.Sprintf("Unknown receiver %s", receiver), http.StatusNotFound)
+		return
+	}
+
+	metrics.WebhooksReceived.WithLabelValues(receiver).Inc()
+	start := time.Now()
+	defer func() {
+		metrics.WebhookDuration.WithLabelValues(receiver).Observe(time.Since(start).Seconds())
+	}()
+
 	var body alertmanager.RequestBody
 
 	decoder := json.NewDecoder(request.Body)
 	err := decoder.Decode(&body)
 	if err != nil {
-		log.Println("Malformed request received from alertmanager")
+		logger.Warn("Malformed request received from alertmanager", logging.Error(err))
 		http.Error(responseWriter, "Malformed request", http.StatusBadRequest)
 		return
 	}
+	for _, alert := range body.Alerts {
+		metrics.AlertsReceived.WithLabelValues(alert.Status, metrics.Severity(alert.Labels["severity"])).Inc()
+	}
+
+	if queue != nil {
+		enqueueAlerts(responseWriter, request, logger, body, receiver)
+	} else {
+		notifyAlerts(responseWriter, request, logger, body, receiver, n)
+	}
+}
+
+// enqueueAlerts persists the alerts in the queue to be delivered
+// asynchronously.
+func enqueueAlerts(responseWriter http.ResponseWriter, request *http.Request, logger *slog.Logger, body alertmanager.RequestBody, receiver string) {
+	data := make([]*alertmanager.Data, 0, len(body.Alerts))
+	for _, alert := range body.Alerts {
+		data = append(data, alertmanager.NewData(body, alert))
+	}
+
+	_, err := queue.Enqueue(request.Context(), receiver, data...)
+	if err != nil {
+		logger.Error("Error queueing alerts", logging.Error(err))
+		http.Error(responseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	response := alertsResponse{Alerts: []alertResult{}}
+	for _, alert := range body.Alerts {
+		logger.Info("Alert queued", alert.LogAttrs()...)
+		response.Alerts = append(response.Alerts, alertResult{Fingerprint: alert.Fingerprint, Alertname: alert.Labels["alertname"], Status: alert.Status, Result: resultQueued})
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(responseWriter).Encode(response)
+}
 
+// notifyAlerts delivers the alerts while alertmanager waits for the response.
+// Failed alerts are left to the retries of the webhook by alertmanager and
+// stored in the dead letters until a retry of the webhook delivers them.
+func notifyAlerts(responseWriter http.ResponseWriter, request *http.Request, logger *slog.Logger, body alertmanager.RequestBody, receiver string, n notifier.Notifier) {
+	endpoint := receiverEndpoint(receiver)
+	response := alertsResponse{Alerts: []alertResult{}}
+	statusCode := http.StatusOK
 	for _, alert := range body.Alerts {
-		err := s.Notify(alert)
+		result := alertResult{Fingerprint: alert.Fingerprint, Alertname: alert.Labels["alertname"], Status: alert.Status}
+		alertLogger := logger.With(alert.LogAttrs()...)
+
+		ctx, span := tracing.Start(request.Context(), "alert", append(tracing.AlertAttributes(alert), tracing.ReceiverKey.String(receiver))...)
+
+		key := delivery.Key(endpoint, alert)
+		if tracker.Delivered(key) {
+			alertLogger.Info("Alert already delivered, skipping it")
+			result.Result = resultSkipped
+			span.SetAttributes(tracing.ResultKey.String(result.Result))
+			tracing.End(span, nil)
+			response.Alerts = append(response.Alerts, result)
+			continue
+		}
+
+		data := alertmanager.NewData(body, alert)
+		ctx = notifier.WithTracking(logging.WithLogger(ctx, alertLogger), tracker, key)
+		err := n.Notify(ctx, data)
+		tracing.End(span, err)
 		if err != nil {
-			log.Printf("Error from notifier: %s", err)
-			switch err.(type) {
-			case notifier.ErrNotAvailable:
-				http.Error(responseWriter, err.Error(), http.StatusGatewayTimeout)
-				return
-			case notifier.ErrHTTPError:
-				http.Error(responseWriter, err.Error(), http.StatusBadGateway)
-				return
-			default:
-				http.Error(responseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-				return
+			alertLogger.Error("Alert not delivered", logging.Error(err))
+			var alertStatusCode int
+			result.Result = resultFailed
+			result.Error, alertStatusCode = failure(err)
+			statusCode = aggregateStatusCode(statusCode, alertStatusCode)
+
+			_, err = deadLetters.Add(receiver, data, delivery.NewAttempt(err))
+			if err != nil {
+				alertLogger.Error("Error storing alert in the dead letters", logging.Error(err))
+			}
+		} else {
+			tracker.MarkDelivered(key)
+			result.Result = resultDelivered
+
+			err = deadLetters.Resolve(receiver, alert)
+			if err != nil {
+				alertLogger.Error("Error removing alert from the dead letters", logging.Error(err))
 			}
 		}
+		response.Alerts = append(response.Alerts, result)
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(response)
+}
+
+// receiverEndpoint returns the path of the endpoint receiving the alerts of
+// the receiver, which identifies their deliveries in the tracker.
+func receiverEndpoint(receiver string) string {
+	if len(receiver) == 0 {
+		return "/alerts"
+	}
+	return "/alerts/" + receiver
+}
+
+// failure returns the error message and status code reported for a failed
+// delivery. The message of internal errors is not exposed.
+func failure(err error) (string, int) {
+	statusCode := errorStatusCode(err)
+	if statusCode == http.StatusInternalServerError {
+		return http.StatusText(statusCode), statusCode
+	}
+	return err.Error(), statusCode
+}
+
+// aggregateStatusCode returns the status code of a response reporting
+// several results, keeping the code of the most severe failure.
+func aggregateStatusCode(statusCode int, resultStatusCode int) int {
+	if resultStatusCode < http.StatusBadRequest {
+		return statusCode
+	}
+	if statusCode < http.StatusBadRequest {
+		return resultStatusCode
+	}
+	return min(statusCode, resultStatusCode)
+}
+
+// errorStatusCode returns the status code to answer to alertmanager when the
+// notifier fails. When several notifiers fail, the code of the most severe
+// error is returned: internal errors first, then errors returned by the
+// destination and lastly destinations not available, either because their
+// circuit breaker is open or because they didn't answer.
+func errorStatusCode(err error) int {
+	var errs interface{ Unwrap() []error }
+	var errNotAvailable notifier.ErrNotAvailable
+	var errHTTPError notifier.ErrHTTPError
+	var errCircuitOpen notifier.ErrCircuitOpen
+	switch {
+	case errors.As(err, &errs):
+		statusCode := http.StatusGatewayTimeout
+		for _, err := range errs.Unwrap() {
+			statusCode = min(statusCode, errorStatusCode(err))
+		}
+		return statusCode
+	case errors.As(err, &errNotAvailable):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &errHTTPError):
+		return http.StatusBadGateway
+	case errors.As(err, &errCircuitOpen):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+var breakerStates = []string{string(notifier.BreakerClosed), string(notifier.BreakerOpen), string(notifier.BreakerHalfOpen)}
+
+// circuitBreakers returns the state of the active circuit breakers by
+// notifier name.
+func circuitBreakers() map[string]string {
+	states := map[string]string{}
+	for name, breaker := range routing.Load().Breakers {
+		states[name] = string(breaker.State())
 	}
+	return states
 }
 
 func handleHealth(responseWriter http.ResponseWriter, request *http.Request) {
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/delivery"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+)
+
+// alertNotifier fails the alerts with the error set for their alertname and
+// counts the deliveries of each alertname.
+type alertNotifier struct {
+	mutex sync.Mutex
+	errs  map[string]error
+	calls map[string]int
+}
+
+func newAlertNotifier(errs map[string]error) *alertNotifier {
+	return &alertNotifier{errs: errs, calls: map[string]int{}}
+}
+
+func (a *alertNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	alertname := data.Labels["alertname"]
+	a.calls[alertname]++
+	return a.errs[alertname]
+}
+
+func (a *alertNotifier) setErr(alertname string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.errs[alertname] = err
+}
+
+// setupHandlers sets the globals used by the handlers, delivering the alerts
+// of /alerts with router and the ones of /alerts/ops with ops.
+func setupHandlers(t *testing.T, router notifier.Notifier, ops notifier.Notifier) {
+	var err error
+	deadLetters, err = delivery.OpenDeadLetters("", 100)
+	if err != nil {
+		t.Fatalf("Unexpected error opening dead letters: %s", err)
+	}
+	tracker = delivery.NewTracker(time.Hour)
+	queue = nil
+	routing.Store(&notifier.Routing{Router: router, Receivers: map[string]notifier.Notifier{"ops": ops}})
+}
+
+func postAlerts(t *testing.T, handler http.HandlerFunc, path string, alerts ...alertmanager.Alert) (int, alertsResponse) {
+	body, err := json.Marshal(alertmanager.RequestBody{Version: "4", Status: "firing", Alerts: alerts})
+	if err != nil {
+		t.Fatalf("Unexpected error encoding the alerts: %s", err)
+	}
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body)))
+	if receiver, ok := strings.CutPrefix(path, "/alerts/"); ok {
+		request.SetPathValue("receiver", receiver)
+	}
+	recorder := httptest.NewRecorder()
+
+	handler(recorder, request)
+
+	var response alertsResponse
+	if recorder.Code != http.StatusNotFound {
+		err = json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding the response: %s", err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func testAlert(alertname string) alertmanager.Alert {
+	return alertmanager.Alert{Status: "firing", Labels: alertmanager.KV{"alertname": alertname}, Fingerprint: "fp-" + alertname, StartsAt: time.Unix(1704067200, 0)}
+}
+
+func Test_handleAlerts(t *testing.T) {
+	n := newAlertNotifier(map[string]error{
+		"Rejected":    notifier.NewErrHTTPError(http.StatusBadRequest, "Bad Request"),
+		"Unavailable": notifier.NewErrNotAvailable("http://gotify", "timeout"),
+		"Internal":    errors.New("template error"),
+	})
+	setupHandlers(t, n, nil)
+
+	statusCode, response := postAlerts(t, handleAlerts, "/alerts", testAlert("Delivered"), testAlert("Rejected"), testAlert("Unavailable"), testAlert("Internal"))
+
+	if statusCode != http.StatusInternalServerError {
+		t.Errorf("Status code was incorrect want: %+v, but got: %+v", http.StatusInternalServerError, statusCode)
+	}
+	want := []alertResult{
+		{Fingerprint: "fp-Delivered", Alertname: "Delivered", Status: "firing", Result: resultDelivered},
+		{Fingerprint: "fp-Rejected", Alertname: "Rejected", Status: "firing", Result: resultFailed, Error: "destination returned and error. Code: 400 Reason: Bad Request"},
+		{Fingerprint: "fp-Unavailable", Alertname: "Unavailable", Status: "firing", Result: resultFailed, Error: "notifier http://gotify not available: timeout"},
+		{Fingerprint: "fp-Internal", Alertname: "Internal", Status: "firing", Result: resultFailed, Error: http.StatusText(http.StatusInternalServerError)},
+	}
+	if len(response.Alerts) != len(want) {
+		t.Fatalf("Results were incorrect want: %+v, but got: %+v", want, response.Alerts)
+	}
+	for i, result := range response.Alerts {
+		if result != want[i] {
+			t.Errorf("Result was incorrect want: %+v, but got: %+v", want[i], result)
+		}
+	}
+}
+
+func Test_handleAlerts_retry(t *testing.T) {
+	n := newAlertNotifier(map[string]error{"Failed": notifier.NewErrNotAvailable("http://gotify", "timeout")})
+	setupHandlers(t, n, nil)
+
+	statusCode, _ := postAlerts(t, handleAlerts, "/alerts", testAlert("Delivered"), testAlert("Failed"))
+	if statusCode != http.StatusGatewayTimeout {
+		t.Errorf("Status code was incorrect want: %+v, but got: %+v", http.StatusGatewayTimeout, statusCode)
+	}
+
+	n.setErr("Failed", nil)
+	statusCode, response := postAlerts(t, handleAlerts, "/alerts", testAlert("Delivered"), testAlert("Failed"))
+
+	if statusCode != http.StatusOK {
+		t.Errorf("Status code was incorrect want: %+v, but got: %+v", http.StatusOK, statusCode)
+	}
+	if response.Alerts[0].Result != resultSkipped || response.Alerts[1].Result != resultDelivered {
+		t.Errorf("Results were incorrect want: skipped and delivered, but got: %+v", response.Alerts)
+	}
+	if n.calls["Delivered"] != 1 || n.calls["Failed"] != 2 {
+		t.Errorf("Only the failed alert should be delivered again, got calls: %+v", n.calls)
+	}
+}
+
+func Test_handleAlerts_deadLetters(t *testing.T) {
+	notAvailable := notifier.NewErrNotAvailable("http://gotify", "timeout")
+	n := newAlertNotifier(map[string]error{
+		"Unavailable": notAvailable,
+		"Rejected":    notifier.NewErrHTTPError(http.StatusBadRequest, "Bad Request"),
+		"Exhausted":   notifier.NewErrRetriesExhausted(3, notAvailable),
+	})
+	setupHandlers(t, n, nil)
+
+	postAlerts(t, handleAlerts, "/alerts", testAlert("Delivered"), testAlert("Unavailable"), testAlert("Rejected"), testAlert("Exhausted"))
+
+	alertnames := map[string]int{}
+	for _, letter := range deadLetters.List() {
+		alertnames[letter.Data.Labels["alertname"]] = len(letter.Attempts)
+	}
+	want := map[string]int{"Unavailable": 1, "Rejected": 1, "Exhausted": 1}
+	if !maps.Equal(alertnames, want) {
+		t.Fatalf("Every failed alert should be a dead letter want: %+v, but got: %+v", want, alertnames)
+	}
+
+	n.setErr("Exhausted", nil)
+	postAlerts(t, handleAlerts, "/alerts", testAlert("Unavailable"), testAlert("Exhausted"))
+	alertnames = map[string]int{}
+	for _, letter := range deadLetters.List() {
+		alertnames[letter.Data.Labels["alertname"]] = len(letter.Attempts)
+	}
+	want = map[string]int{"Unavailable": 2, "Rejected": 1}
+	if !maps.Equal(alertnames, want) {
+		t.Errorf("Retries should remove the delivered dead letters and add attempts to the failed ones want: %+v, but got: %+v", want, alertnames)
+	}
+}
+
+func Test_handleReceiverAlerts(t *testing.T) {
+	router := newAlertNotifier(map[string]error{})
+	ops := newAlertNotifier(map[string]error{})
+	setupHandlers(t, router, ops)
+
+	statusCode, _ := postAlerts(t, handleReceiverAlerts, "/alerts/ops", testAlert("Delivered"))
+	if statusCode != http.StatusOK || ops.calls["Delivered"] != 1 || router.calls["Delivered"] != 0 {
+		t.Errorf("Alert should be delivered by the receiver notifier, got status %d and calls %+v and %+v", statusCode, ops.calls, router.calls)
+	}
+
+	statusCode, _ = postAlerts(t, handleReceiverAlerts, "/alerts/dev", testAlert("Delivered"))
+	if statusCode != http.StatusNotFound {
+		t.Errorf("Status code was incorrect want: %+v, but got: %+v", http.StatusNotFound, statusCode)
+	}
+}
+
+func Test_errorStatusCode(t *testing.T) {
+	notAvailable := notifier.NewErrNotAvailable("http://gotify", "timeout")
+	httpError := notifier.NewErrHTTPError(http.StatusBadRequest, "Bad Request")
+	circuitOpen := notifier.NewErrCircuitOpen("gotify")
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not available", notAvailable, http.StatusGatewayTimeout},
+		{"http error", httpError, http.StatusBadGateway},
+		{"circuit open", circuitOpen, http.StatusServiceUnavailable},
+		{"internal", errors.New("template error"), http.StatusInternalServerError},
+		{"fan out", notifier.NewErrFanOut(3, []string{"a", "b", "c"}, []error{notAvailable, circuitOpen, httpError}), http.StatusBadGateway},
+		{"fallback", notifier.NewErrFallback([]string{"a", "b"}, []error{notAvailable, circuitOpen}), http.StatusServiceUnavailable},
+		{"retries exhausted", notifier.NewErrRetriesExhausted(3, httpError), http.StatusBadGateway},
+		{"wrapped", fmt.Errorf("chat 1: %w", circuitOpen), http.StatusServiceUnavailable},
+		{"wrapped fan out", notifier.NewErrRetriesExhausted(3, notifier.NewErrFanOut(2, []string{"a", "b"}, []error{notAvailable, errors.New("template error")})), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := errorStatusCode(tt.err); got != tt.want {
+			t.Errorf("%s: Status code was incorrect want: %+v, but got: %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func Test_aggregateStatusCode(t *testing.T) {
+	tests := []struct {
+		statusCode       int
+		resultStatusCode int
+		want             int
+	}{
+		{http.StatusOK, http.StatusOK, http.StatusOK},
+		{http.StatusAccepted, http.StatusOK, http.StatusAccepted},
+		{http.StatusOK, http.StatusGatewayTimeout, http.StatusGatewayTimeout},
+		{http.StatusGatewayTimeout, http.StatusOK, http.StatusGatewayTimeout},
+		{http.StatusGatewayTimeout, http.StatusBadGateway, http.StatusBadGateway},
+		{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusInternalServerError},
+		{http.StatusNotFound, http.StatusBadGateway, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := aggregateStatusCode(tt.statusCode, tt.resultStatusCode); got != tt.want {
+			t.Errorf("Status code of %d and %d was incorrect want: %+v, but got: %+v", tt.statusCode, tt.resultStatusCode, tt.want, got)
+		}
+	}
+}
+
+func replay(t *testing.T, id uint64) (int, replayResponse) {
+	request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/deadletters/%d/replay", id), nil)
+	request.SetPathValue("id", strconv.FormatUint(id, 10))
+	recorder := httptest.NewRecorder()
+
+	handleReplayDeadLetter(recorder, request)
+
+	var response replayResponse
+	if recorder.Code != http.StatusNotFound {
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding the response: %s", err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func Test_handleReplayDeadLetter(t *testing.T) {
+	ops := newAlertNotifier(map[string]error{"Failed": notifier.NewErrHTTPError(http.StatusBadGateway, "Bad Gateway")})
+	setupHandlers(t, newAlertNotifier(map[string]error{}), ops)
+	alert := testAlert("Failed")
+	letter, err := deadLetters.Add("ops", alertmanager.NewData(alertmanager.RequestBody{Receiver: "ops"}, alert), delivery.NewAttempt(errors.New("timeout")))
+	if err != nil {
+		t.Fatalf("Unexpected error adding dead letter: %s", err)
+	}
+
+	statusCode, response := replay(t, letter.ID)
+	if statusCode != http.StatusBadGateway {
+		t.Errorf("Status code was incorrect want: %+v, but got: %+v", http.StatusBadGateway, statusCode)
+	}
+	want := replayResult{ID: letter.ID, Alertname: "Failed", Result: resultFailed, Error: "destination returned and error. Code: 502 Reason: Bad Gateway"}
+	if len(response.DeadLetters) != 1 || response.DeadLetters[0] != want {
+		t.Errorf("Results were incorrect want: %+v, but got: %+v", want, response.DeadLetters)
+	}
+	if stored, ok := deadLetters.Get(letter.ID); !ok || len(stored.Attempts) != 2 {
+		t.Errorf("Failed replay should be kept with the new attempt, got: %+v", stored)
+	}
+
+	ops.setErr("Failed", nil)
+	statusCode, response = replay(t, letter.ID)
+	if statusCode != http.StatusOK || response.DeadLetters[0].Result != resultDelivered {
+		t.Errorf("Replay was incorrect want: 200 and delivered, but got: %d and %+v", statusCode, response.DeadLetters)
+	}
+	if deadLetters.Len() != 0 {
+		t.Errorf("Delivered dead letter should be removed, got: %d", deadLetters.Len())
+	}
+	if !tracker.Delivered(delivery.Key("/alerts/ops", alert)) {
+		t.Errorf("Delivered dead letter should be remembered as delivered")
+	}
+	_, alertsResponse := postAlerts(t, handleReceiverAlerts, "/alerts/ops", alert)
+	if alertsResponse.Alerts[0].Result != resultSkipped || ops.calls["Failed"] != 2 {
+		t.Errorf("Retry of the webhook should skip the replayed alert, got: %+v and %d calls", alertsResponse.Alerts, ops.calls["Failed"])
+	}
+
+	statusCode, _ = replay(t, letter.ID)
+	if statusCode != http.StatusNotFound {
+		t.Errorf("Status code was incorrect want: %+v, but got: %+v", http.StatusNotFound, statusCode)
+	}
+}
+
+func Test_handleDeadLetters(t *testing.T) {
+	setupHandlers(t, newAlertNotifier(map[string]error{}), newAlertNotifier(map[string]error{}))
+	for _, receiver := range []string{"", "ops"} {
+		_, err := deadLetters.Add(receiver, alertmanager.NewData(alertmanager.RequestBody{}, testAlert("Failed"+receiver)), delivery.NewAttempt(errors.New("timeout")))
+		if err != nil {
+			t.Fatalf("Unexpected error adding dead letter: %s", err)
+		}
+	}
+
+	for path, want := range map[string]int{"/api/deadletters": 2, "/api/deadletters?receiver=ops": 1, "/api/deadletters?receiver=": 1} {
+		recorder := httptest.NewRecorder()
+		handleDeadLetters(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var response deadLettersResponse
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding the response: %s", err)
+		}
+		if len(response.DeadLetters) != want {
+			t.Errorf("Dead letters of %s were incorrect want: %d, but got: %+v", path, want, response.DeadLetters)
+		}
+	}
+}
+
+func Test_handleHealth(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	handleHealth(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "Ok" {
+		t.Errorf("Health was incorrect want: 200 Ok, but got: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
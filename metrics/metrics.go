@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "alertmanager_notifier"
+
+// Registry holds the metrics of the service along with the Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// WebhooksReceived counts the webhooks received by receiver, empty for
+	// /alerts.
+	WebhooksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_received_total",
+		Help:      "Webhooks received from Alertmanager.",
+	}, []string{"receiver"})
+
+	// AlertsReceived counts the alerts received by status and severity, as
+	// returned by Severity.
+	AlertsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_received_total",
+		Help:      "Alerts received from Alertmanager.",
+	}, []string{"status", "severity"})
+
+	// WebhookDuration observes the time taken to handle the webhooks by
+	// receiver.
+	WebhookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_duration_seconds",
+		Help:      "Time taken to handle the webhooks received from Alertmanager.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"receiver"})
+
+	// NotificationsSent counts the notifications delivered by notifier.
+	NotificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Notifications delivered, after retries.",
+	}, []string{"notifier"})
+
+	// NotificationsFailed counts the notifications that could not be
+	// delivered by notifier and error class.
+	NotificationsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_failed_total",
+		Help:      "Notifications that could not be delivered, after retries.",
+	}, []string{"notifier", "class"})
+
+	// Retries counts the delivery retries by notifier.
+	Retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Delivery attempts retried.",
+	}, []string{"notifier"})
+
+	// BackendDuration observes the time taken by the requests to the
+	// destinations by notifier.
+	BackendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backend_request_duration_seconds",
+		Help:      "Time taken by the requests to the notification destinations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"notifier"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		WebhooksReceived,
+		AlertsReceived,
+		WebhookDuration,
+		NotificationsSent,
+		NotificationsFailed,
+		Retries,
+		BackendDuration,
+	)
+}
+
+// severities are the values of the severity label of AlertsReceived, besides
+// none and other.
+var severities = []string{"critical", "error", "warning", "info"}
+
+// Severity returns the severity label of AlertsReceived for the severity
+// label of an alert: one of the known severities ignoring case, none when the
+// alert has no severity and other for the rest, so alerts with arbitrary
+// severities don't create new series.
+func Severity(severity string) string {
+	if len(severity) == 0 {
+		return "none"
+	}
+	severity = strings.ToLower(severity)
+	if slices.Contains(severities, severity) {
+		return severity
+	}
+	return "other"
+}
+
+// Handler returns the handler exposing the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// circuitBreakersCollector reports the state of the circuit breakers on each
+// scrape, so it follows the breakers swapped on reloads.
+type circuitBreakersCollector struct {
+	desc     *prometheus.Desc
+	states   []string
+	breakers func() map[string]string
+}
+
+func (c circuitBreakersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c circuitBreakersCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, current := range c.breakers() {
+		for _, state := range c.states {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, value, name, state)
+		}
+	}
+}
+
+// RegisterCircuitBreakers registers the metric reporting the state of the
+// circuit breakers returned by breakers, by notifier name. Each breaker has
+// a series per state, 1 for its current state and 0 for the rest.
+func RegisterCircuitBreakers(states []string, breakers func() map[string]string) {
+	Registry.MustRegister(newCircuitBreakersCollector(states, breakers))
+}
+
+func newCircuitBreakersCollector(states []string, breakers func() map[string]string) prometheus.Collector {
+	return circuitBreakersCollector{
+		desc:     prometheus.NewDesc(namespace+"_circuit_breaker_state", "State of the circuit breakers of the notifiers.", []string{"notifier", "state"}, nil),
+		states:   states,
+		breakers: breakers,
+	}
+}
+
+// RegisterQueueLength registers the metric reporting the number of alerts
+// waiting in the queue.
+func RegisterQueueLength(length func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_length",
+		Help:      "Alerts waiting in the queue to be delivered.",
+	}, func() float64 { return float64(length()) }))
+}
+
+// RegisterDeadLetters registers the metric reporting the number of dead
+// letters.
+func RegisterDeadLetters(count func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dead_letters",
+		Help:      "Alerts that could not be delivered waiting to be replayed.",
+	}, func() float64 { return float64(count()) }))
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_circuitBreakersCollector(t *testing.T) {
+	breakers := map[string]string{"gotify": "open", "ntfy": "closed"}
+	collector := newCircuitBreakersCollector([]string{"closed", "open"}, func() map[string]string { return breakers })
+
+	expected := `
+# HELP alertmanager_notifier_circuit_breaker_state State of the circuit breakers of the notifiers.
+# TYPE alertmanager_notifier_circuit_breaker_state gauge
+alertmanager_notifier_circuit_breaker_state{notifier="gotify",state="closed"} 0
+alertmanager_notifier_circuit_breaker_state{notifier="gotify",state="open"} 1
+alertmanager_notifier_circuit_breaker_state{notifier="ntfy",state="closed"} 1
+alertmanager_notifier_circuit_breaker_state{notifier="ntfy",state="open"} 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected))
+	if err != nil {
+		t.Errorf("Circuit breaker metrics were incorrect: %s", err)
+	}
+
+	breakers = map[string]string{}
+	if got := testutil.CollectAndCount(collector); got != 0 {
+		t.Errorf("Number of metrics was incorrect after a reload want: %+v, but got: %+v", 0, got)
+	}
+}
+
+func Test_Severity(t *testing.T) {
+	tests := map[string]string{
+		"critical": "critical",
+		"Warning":  "warning",
+		"INFO":     "info",
+		"error":    "error",
+		"":         "none",
+		"page":     "other",
+		"p1":       "other",
+	}
+	for severity, want := range tests {
+		if got := Severity(severity); got != want {
+			t.Errorf("Severity of %q was incorrect want: %+v, but got: %+v", severity, want, got)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+const defaultOpenMillis = 30000
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed delivers the alerts.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails the deliveries without trying them.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single delivery through to probe whether the
+	// destination recovered.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig configures the circuit breaker of a notifier. The circuit
+// breaker is disabled unless FailureThreshold is greater than 0.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed deliveries that
+	// opens the circuit.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// OpenMillis is the time the circuit stays open before probing the
+	// destination.
+	OpenMillis int `yaml:"open_millis"`
+}
+
+func (c BreakerConfig) validate() error {
+	errs := []error{}
+	if c.FailureThreshold < 0 {
+		errs = append(errs, fmt.Errorf("invalid circuit breaker failure threshold %d, must be a positive number", c.FailureThreshold))
+	}
+	if c.OpenMillis < 0 {
+		errs = append(errs, fmt.Errorf("invalid circuit breaker open time %d, must be a positive number", c.OpenMillis))
+	}
+	return errors.Join(errs...)
+}
+
+type ErrCircuitOpen struct {
+	name string
+}
+
+func NewErrCircuitOpen(name string) error {
+	return ErrCircuitOpen{name: name}
+}
+
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit breaker of notifier %s is open", e.name)
+}
+
+// Breaker is a circuit breaker failing the deliveries of a notifier without
+// trying them while its destination is down, so they don't wait for its
+// timeout. Only connection errors, timeouts and server errors of the
+// destination count as failures.
+type Breaker struct {
+	name             string
+	notifier         Notifier
+	failureThreshold int
+	openTime         time.Duration
+	now              func() time.Time
+
+	mutex    sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a circuit breaker around n.
+func NewBreaker(name string, n Notifier, config BreakerConfig) *Breaker {
+	b := &Breaker{
+		name:             name,
+		notifier:         n,
+		failureThreshold: config.FailureThreshold,
+		openTime:         defaultOpenMillis * time.Millisecond,
+		now:              time.Now,
+		state:            BreakerClosed,
+	}
+	if config.OpenMillis > 0 {
+		b.openTime = time.Duration(config.OpenMillis) * time.Millisecond
+	}
+	return b
+}
+
+// State returns the current state of the circuit.
+func (b *Breaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTime {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// restore carries the state of previous over, so a reload doesn't close the
+// circuit of a destination that is down. A probe in flight in previous is
+// not carried over, so the half-open circuit lets a new one through.
+func (b *Breaker) restore(previous *Breaker) {
+	previous.mutex.Lock()
+	state, failures, openedAt := previous.state, previous.failures, previous.openedAt
+	previous.mutex.Unlock()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.state = state
+	b.failures = failures
+	b.openedAt = openedAt
+}
+
+func (b *Breaker) Notify(ctx context.Context, data *alertmanager.Data) error {
+	if !b.allow() {
+		return NewErrCircuitOpen(b.name)
+	}
+
+	err := b.notifier.Notify(ctx, data)
+	// Deliveries cancelled by the caller say nothing about the destination.
+	if ctx.Err() != nil {
+		b.record(false, false)
+	} else {
+		b.record(isBackendUp(err), isBackendFailure(err))
+	}
+	return err
+}
+
+// allow returns whether a delivery can be tried, moving an open circuit to
+// half-open once the open time has elapsed.
+func (b *Breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTime {
+			return false
+		}
+		slog.Info("Circuit breaker half-open, probing the destination", logging.NotifierKey, b.name)
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the state with the result of a delivery. Results that are
+// neither a success nor a failure, like errors rendering the templates,
+// leave it unchanged.
+func (b *Breaker) record(success bool, failure bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	wasHalfOpen := b.state == BreakerHalfOpen
+	b.probing = false
+	switch {
+	case success:
+		if b.state != BreakerClosed {
+			slog.Info("Circuit breaker closed", logging.NotifierKey, b.name)
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+	case failure:
+		b.failures++
+		if wasHalfOpen || b.failures >= b.failureThreshold {
+			if b.state != BreakerOpen {
+				slog.Warn("Circuit breaker opened", logging.NotifierKey, b.name, "failures", b.failures)
+			}
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+		}
+	}
+}
+
+// isBackendUp returns whether err shows the destination is up, either
+// because the delivery succeeded or because the destination rejected it.
+func isBackendUp(err error) bool {
+	if err == nil {
+		return true
+	}
+	var errHTTPError ErrHTTPError
+	return errors.As(err, &errHTTPError) && !isBackendFailure(err)
+}
+
+// isBackendFailure returns whether err, or any of the errors it wraps, shows
+// the destination is down.
+func isBackendFailure(err error) bool {
+	var errNotAvailable ErrNotAvailable
+	if errors.As(err, &errNotAvailable) {
+		return true
+	}
+	for _, errHTTPError := range httpErrors(err) {
+		if errHTTPError.Code() >= http.StatusInternalServerError || errHTTPError.Code() == http.StatusTooManyRequests {
+			return true
+		}
+	}
+	return false
+}
+
+// httpErrors returns the errors returned by the destinations wrapped by err,
+// at any depth.
+func httpErrors(err error) []ErrHTTPError {
+	var errs interface{ Unwrap() []error }
+	if errors.As(err, &errs) {
+		httpErrs := []ErrHTTPError{}
+		for _, err := range errs.Unwrap() {
+			httpErrs = append(httpErrs, httpErrors(err)...)
+		}
+		return httpErrs
+	}
+	var errHTTPError ErrHTTPError
+	if errors.As(err, &errHTTPError) {
+		return []ErrHTTPError{errHTTPError}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_breaker(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	notAvailable := NewErrNotAvailable("http://ntfy", "connection refused")
+	n := &sequenceNotifier{errs: []error{notAvailable, notAvailable, notAvailable}}
+	breaker := NewBreaker("ntfy", n, BreakerConfig{FailureThreshold: 2, OpenMillis: 1000})
+	breaker.now = func() time.Time { return now }
+	data := &alertmanager.Data{}
+
+	for range 2 {
+		breaker.Notify(context.Background(), data)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("State was incorrect want: %+v, but got: %+v", BreakerOpen, breaker.State())
+	}
+
+	err := breaker.Notify(context.Background(), data)
+	if _, ok := err.(ErrCircuitOpen); !ok {
+		t.Errorf("Error was incorrect want: %+v, but got: %+v", NewErrCircuitOpen("ntfy"), err)
+	}
+	if n.calls != 2 {
+		t.Errorf("Deliveries should not be tried while the circuit is open, got %d calls", n.calls)
+	}
+
+	now = now.Add(time.Second)
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("State was incorrect want: %+v, but got: %+v", BreakerHalfOpen, breaker.State())
+	}
+	breaker.Notify(context.Background(), data)
+	if breaker.State() != BreakerOpen || n.calls != 3 {
+		t.Fatalf("Failed probe should open the circuit again, got state %s and %d calls", breaker.State(), n.calls)
+	}
+
+	now = now.Add(time.Second)
+	err = breaker.Notify(context.Background(), data)
+	if err != nil || breaker.State() != BreakerClosed {
+		t.Errorf("Successful probe should close the circuit, got state %s and error %v", breaker.State(), err)
+	}
+}
+
+func Test_breaker_failures(t *testing.T) {
+	notAvailable := NewErrNotAvailable("http://ntfy", "connection refused")
+	tests := []struct {
+		name string
+		errs []error
+		want BreakerState
+	}{
+		{"server errors", []error{NewErrHTTPError(http.StatusBadGateway, "Bad Gateway"), NewErrHTTPError(http.StatusTooManyRequests, "Too Many Requests")}, BreakerOpen},
+		{"rejected delivery resets failures", []error{notAvailable, NewErrHTTPError(http.StatusBadRequest, "Bad Request"), notAvailable}, BreakerClosed},
+		{"internal errors are ignored", []error{notAvailable, errors.New("template error"), notAvailable}, BreakerOpen},
+		{"wrapped errors", []error{fmt.Errorf("chat 1: %w", notAvailable), errors.Join(NewErrHTTPError(http.StatusBadRequest, "Bad Request"), NewErrHTTPError(http.StatusServiceUnavailable, "Service Unavailable"))}, BreakerOpen},
+		{"wrapped rejected delivery resets failures", []error{notAvailable, fmt.Errorf("chat 1: %w", NewErrHTTPError(http.StatusBadRequest, "Bad Request")), notAvailable}, BreakerClosed},
+	}
+
+	for _, test := range tests {
+		n := &sequenceNotifier{errs: test.errs}
+		breaker := NewBreaker("ntfy", n, BreakerConfig{FailureThreshold: 2})
+		for range test.errs {
+			breaker.Notify(context.Background(), &alertmanager.Data{})
+		}
+		if breaker.State() != test.want {
+			t.Errorf("%s: State was incorrect want: %+v, but got: %+v", test.name, test.want, breaker.State())
+		}
+	}
+}
+
+func Test_breaker_cancelled(t *testing.T) {
+	notAvailable := NewErrNotAvailable("http://ntfy", "context canceled")
+	n := &sequenceNotifier{errs: []error{notAvailable, notAvailable}}
+	breaker := NewBreaker("ntfy", n, BreakerConfig{FailureThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	breaker.Notify(ctx, &alertmanager.Data{})
+	if breaker.State() != BreakerClosed {
+		t.Errorf("Cancelled deliveries should not open the circuit, got: %+v", breaker.State())
+	}
+}
+
+func Test_breaker_stopsRetries(t *testing.T) {
+	notAvailable := NewErrNotAvailable("http://ntfy", "connection refused")
+	n := &sequenceNotifier{errs: []error{notAvailable, notAvailable, notAvailable, notAvailable}}
+	retry := NewRetry("ntfy", NewBreaker("ntfy", n, BreakerConfig{FailureThreshold: 2}), testRetryConfig(4))
+
+	err := retry.Notify(context.Background(), &alertmanager.Data{})
+	if _, ok := err.(ErrCircuitOpen); !ok {
+		t.Errorf("Error was incorrect want: %+v, but got: %+v", NewErrCircuitOpen("ntfy"), err)
+	}
+	if n.calls != 2 {
+		t.Errorf("Retries should stop once the circuit opens, got %d calls", n.calls)
+	}
+}
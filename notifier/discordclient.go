@@ -0,0 +1,240 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	urlPkg "net/url"
+	"os"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const (
+	discordWebhookURLEnvVariable    = "DISCORD_WEBHOOK_URL"
+	discordTimeoutMillisEnvVariable = "DISCORD_TIMEOUT_MILLIS"
+)
+
+// Limits of the discord embeds.
+const (
+	discordMaxUsernameLength    = 80
+	discordMaxTitleLength       = 256
+	discordMaxDescriptionLength = 4096
+	discordMaxFields            = 25
+	discordMaxFieldNameLength   = 256
+	discordMaxFieldValueLength  = 1024
+	discordMaxEmbedLength       = 6000
+)
+
+// DiscordConfig configures a discord notifier. Fields not set are taken from
+// the environment variables.
+type DiscordConfig struct {
+	// WebhookURL is the URL of the webhook of the channel, which includes
+	// its token.
+	WebhookURL string `yaml:"webhook_url"`
+	// Username overrides the name of the webhook in the messages.
+	Username      string `yaml:"username"`
+	TimeoutMillis int    `yaml:"timeout_millis"`
+}
+
+func (c *DiscordConfig) setDefaults() error {
+	if len(c.WebhookURL) == 0 {
+		c.WebhookURL = os.Getenv(discordWebhookURLEnvVariable)
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getTimeoutMillisEnvVariable(discordTimeoutMillisEnvVariable)
+		if err != nil {
+			return err
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	return nil
+}
+
+type discordClient struct {
+	webhookURL string
+	username   string
+	template   *alertmanager.Template
+	timeout    time.Duration
+
+	httpClient http.Client
+}
+
+type discordMessage struct {
+	Username        string                `json:"username,omitempty"`
+	Embeds          []discordEmbed        `json:"embeds"`
+	AllowedMentions discordAllowedMention `json:"allowed_mentions"`
+}
+
+// discordAllowedMention sets which mentions in the message notify. None
+// does, so alert text can't ping the channel.
+type discordAllowedMention struct {
+	Parse []string `json:"parse"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordResponse is the body of the discord error responses.
+type discordResponse struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+}
+
+// newDiscordClient returns a discord client configured with config. All the
+// problems found in the configuration are returned at once.
+func newDiscordClient(config DiscordConfig, template *alertmanager.Template) (*discordClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(config.WebhookURL) == 0 {
+		errs = append(errs, fmt.Errorf("discord webhook url is required"))
+	} else if _, err := urlPkg.ParseRequestURI(config.WebhookURL); err != nil {
+		// The error is not included, as it contains the token.
+		errs = append(errs, fmt.Errorf("invalid discord webhook url"))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid discord timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &discordClient{
+		webhookURL: config.WebhookURL,
+		username:   truncate(config.Username, discordMaxUsernameLength),
+		template:   template,
+		timeout:    time.Duration(config.TimeoutMillis) * time.Millisecond,
+		httpClient: newHTTPClient(),
+	}, nil
+}
+
+func (d *discordClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, err := d.template.Render(data)
+	if err != nil {
+		return err
+	}
+
+	discordMessage := discordMessage{
+		Username:        d.username,
+		Embeds:          []discordEmbed{discordAlertEmbed(data, title, message)},
+		AllowedMentions: discordAllowedMention{Parse: []string{}},
+	}
+	body, err := json.Marshal(discordMessage)
+	if err != nil {
+		return fmt.Errorf("could not marshal discord message: %s", err)
+	}
+	return d.do(ctx, http.MethodPost, bytes.NewReader(body))
+}
+
+// discordAlertEmbed returns the embed of the alert, colored by its status and
+// severity, with a field per label. It fits the limits of discord: the
+// texts are truncated and, when the embed is still too long, the last
+// fields are left out.
+func discordAlertEmbed(data *alertmanager.Data, title string, message string) discordEmbed {
+	embed := discordEmbed{
+		Title:       truncate(title, discordMaxTitleLength),
+		Description: truncate(message, discordMaxDescriptionLength),
+		URL:         data.GeneratorURL,
+		Color:       alertColor(data),
+	}
+	if !data.StartsAt.IsZero() {
+		embed.Timestamp = data.StartsAt.UTC().Format(time.RFC3339)
+	}
+	for _, label := range data.Labels.SortedPairs() {
+		if len(embed.Fields) == discordMaxFields {
+			break
+		}
+		embed.Fields = append(embed.Fields, discordField{
+			Name:   truncate(label.Name, discordMaxFieldNameLength),
+			Value:  truncate(nonEmpty(label.Value), discordMaxFieldValueLength),
+			Inline: true,
+		})
+	}
+
+	for embed.length() > discordMaxEmbedLength && len(embed.Fields) != 0 {
+		embed.Fields = embed.Fields[:len(embed.Fields)-1]
+	}
+	return embed
+}
+
+// length returns the number of characters of the embed counted by discord
+// against its limit.
+func (e discordEmbed) length() int {
+	length := len([]rune(e.Title)) + len([]rune(e.Description))
+	for _, field := range e.Fields {
+		length += len([]rune(field.Name)) + len([]rune(field.Value))
+	}
+	return length
+}
+
+// Probe checks discord accepts the webhook URL, without posting any message.
+func (d *discordClient) Probe(ctx context.Context) error {
+	return d.do(ctx, http.MethodGet, nil)
+}
+
+// do makes a request to the webhook. Its URL is left out of the errors, as it
+// contains the token.
+func (d *discordClient) do(ctx context.Context, method string, body io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, d.webhookURL, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.httpClient.Do(request)
+	if err != nil {
+		return newErrRedactedNotAvailable(redactURL(d.webhookURL), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newDiscordError(resp)
+	}
+	return nil
+}
+
+// newDiscordError returns the error for a failed response, with the message
+// and the delay to retry reported by discord in its body, if any. The delay
+// of the body is preferred, as the Retry-After header is rounded up to
+// seconds.
+func newDiscordError(resp *http.Response) error {
+	var body discordResponse
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(content, &body)
+	return newErrHTTPErrorFromResponse(resp, body.Message, time.Duration(math.Ceil(body.RetryAfter*1000))*time.Millisecond)
+}
+
+// nonEmpty returns value, or a placeholder when it is empty, as discord
+// rejects empty fields.
+func nonEmpty(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
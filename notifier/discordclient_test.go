@@ -0,0 +1,174 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_newDiscordClient_invalidConfig(t *testing.T) {
+	_, err := newDiscordClient(DiscordConfig{}, alertmanager.DefaultTemplate())
+
+	if err == nil || !strings.Contains(err.Error(), "webhook url is required") {
+		t.Errorf("Expected an error for a missing webhook url, got: %v", err)
+	}
+}
+
+func Test_discordClientNotify(t *testing.T) {
+	messages := make(chan discordMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message discordMessage
+		err := json.NewDecoder(r.Body).Decode(&message)
+		if err != nil {
+			t.Errorf("Unexpected error decoding the request: %s", err)
+		}
+		messages <- message
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client, err := newDiscordClient(DiscordConfig{WebhookURL: server.URL + "/api/webhooks/1/token", Username: "Alertmanager"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	alert := alertmanager.Alert{
+		Status:       "firing",
+		Labels:       alertmanager.KV{"alertname": "Disk_Full", "severity": "warning", "instance": ""},
+		Annotations:  alertmanager.KV{"description": "Usage is 95%"},
+		StartsAt:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)),
+		GeneratorURL: "https://prometheus/graph",
+	}
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	message := <-messages
+	if message.Username != "Alertmanager" || message.AllowedMentions.Parse == nil || len(message.AllowedMentions.Parse) != 0 {
+		t.Errorf("Message should have the username and allow no mentions, got: %+v", message)
+	}
+	embed := message.Embeds[0]
+	if embed.Color != colorWarning || embed.URL != alert.GeneratorURL || embed.Timestamp != "2024-01-01T11:00:00Z" {
+		t.Errorf("Embed was incorrect want: color %d, url %s and timestamp 2024-01-01T11:00:00Z, but got: %+v", colorWarning, alert.GeneratorURL, embed)
+	}
+	if !strings.Contains(embed.Description, "Usage is 95%") {
+		t.Errorf("Description should contain the message, got: %q", embed.Description)
+	}
+	wantFields := []discordField{{Name: "alertname", Value: "Disk_Full", Inline: true}, {Name: "instance", Value: "-", Inline: true}, {Name: "severity", Value: "warning", Inline: true}}
+	if len(embed.Fields) != len(wantFields) {
+		t.Fatalf("Fields were incorrect want: %+v, but got: %+v", wantFields, embed.Fields)
+	}
+	for i, field := range embed.Fields {
+		if field != wantFields[i] {
+			t.Errorf("Field was incorrect want: %+v, but got: %+v", wantFields[i], field)
+		}
+	}
+}
+
+func Test_discordAlertEmbed_limits(t *testing.T) {
+	labels := alertmanager.KV{}
+	for _, name := range strings.Split("abcdefghijklmnopqrstuvwxyz0123", "") {
+		labels[name] = strings.Repeat("v", 2000)
+	}
+	alert := alertmanager.Alert{Status: "resolved", Labels: labels}
+
+	embed := discordAlertEmbed(alertmanager.NewData(alertmanager.RequestBody{}, alert), strings.Repeat("t", 300), strings.Repeat("ñ", 5000))
+
+	if length := len([]rune(embed.Title)); length != discordMaxTitleLength {
+		t.Errorf("Title length was incorrect want: %d, but got: %d", discordMaxTitleLength, length)
+	}
+	if length := len([]rune(embed.Description)); length != discordMaxDescriptionLength {
+		t.Errorf("Description length was incorrect want: %d, but got: %d", discordMaxDescriptionLength, length)
+	}
+	if embed.length() > discordMaxEmbedLength || len(embed.Fields) != 1 || len([]rune(embed.Fields[0].Value)) != discordMaxFieldValueLength {
+		t.Errorf("Embed should fit the limits with a truncated field, got %d characters and fields %d", embed.length(), len(embed.Fields))
+	}
+	if embed.Color != colorResolved {
+		t.Errorf("Color was incorrect want: %d, but got: %d", colorResolved, embed.Color)
+	}
+}
+
+func Test_discordClientNotify_errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.25,"global":false}`))
+	}))
+	defer server.Close()
+	client, err := newDiscordClient(DiscordConfig{WebhookURL: server.URL + "/api/webhooks/1/token"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+
+	var httpErr ErrHTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Error was incorrect want: ErrHTTPError, but got: %+v", err)
+	}
+	if httpErr.msg != "You are being rate limited." || httpErr.RetryAfter() != 250*time.Millisecond {
+		t.Errorf("Error was incorrect want: You are being rate limited. and %+v, but got: %s and %+v", 250*time.Millisecond, httpErr.msg, httpErr.RetryAfter())
+	}
+
+	server.Close()
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+	if err == nil || strings.Contains(err.Error(), "token") {
+		t.Errorf("Error should leave out the webhook token, got: %v", err)
+	}
+}
+
+func Test_discordClientProbe(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Method was incorrect want: %+v, but got: %+v", http.MethodGet, r.Method)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client, err := newDiscordClient(DiscordConfig{WebhookURL: server.URL + "/api/webhooks/1/token"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Probe(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error probing: %s", err)
+	}
+
+	status = http.StatusUnauthorized
+	err = client.Probe(context.Background())
+	if err == nil {
+		t.Errorf("Probe should fail when discord rejects the webhook")
+	}
+}
+
+func Test_discordClient_spans(t *testing.T) {
+	exporter := recordSpans(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client, err := newDiscordClient(DiscordConfig{WebhookURL: server.URL + "/api/webhooks/1/secret"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	err = client.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error probing: %s", err)
+	}
+
+	checkSpansWithoutSecret(t, exporter, "secret")
+}
@@ -0,0 +1,127 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+// Error classes that can trigger the delivery to the fallback notifiers.
+const (
+	// NotAvailableClass are connection errors and timeouts, ErrNotAvailable.
+	NotAvailableClass string = "not_available"
+	// HTTPErrorClass are error responses of the destination, ErrHTTPError.
+	HTTPErrorClass string = "http_error"
+	// CircuitOpenClass are deliveries failed by an open circuit breaker,
+	// ErrCircuitOpen.
+	CircuitOpenClass string = "circuit_open"
+)
+
+var defaultFallbackClasses = []string{NotAvailableClass, HTTPErrorClass, CircuitOpenClass}
+
+// FallbackConfig configures the notifiers an alert is delivered to, in
+// order, when the delivery with a notifier fails.
+type FallbackConfig struct {
+	Notifiers []string `yaml:"notifiers"`
+	// On are the error classes that trigger the fallback. All of them by
+	// default.
+	On []string `yaml:"on"`
+}
+
+func (c FallbackConfig) validate() error {
+	errs := []error{}
+	for _, class := range c.On {
+		if !slices.Contains(defaultFallbackClasses, class) {
+			errs = append(errs, fmt.Errorf("invalid fallback error class %q, must be one of %s", class, strings.Join(defaultFallbackClasses, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ErrFallback is returned by a fallback notifier when the delivery to the
+// primary notifier and all the fallbacks tried fails. It wraps their errors.
+type ErrFallback struct {
+	names  []string
+	errors []error
+}
+
+func NewErrFallback(names []string, errors []error) error {
+	return ErrFallback{names: names, errors: errors}
+}
+
+func (e ErrFallback) Error() string {
+	failures := make([]string, 0, len(e.errors))
+	for i, err := range e.errors {
+		failures = append(failures, fmt.Sprintf("%s: %s", e.names[i], err))
+	}
+	return fmt.Sprintf("delivery failed for %s and its fallbacks: %s", e.names[0], strings.Join(failures, "; "))
+}
+
+func (e ErrFallback) Unwrap() []error {
+	return e.errors
+}
+
+type fallbackNotifier struct {
+	destinations []Destination
+	classes      []string
+}
+
+// NewFallback returns a notifier delivering each alert to the first
+// destination and, when it fails with an error of the given classes, to the
+// following ones in order until one succeeds.
+func NewFallback(classes []string, destinations ...Destination) Notifier {
+	if len(classes) == 0 {
+		classes = defaultFallbackClasses
+	}
+	return &fallbackNotifier{destinations: destinations, classes: classes}
+}
+
+func (f *fallbackNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	logger := logging.FromContext(ctx)
+	names := []string{}
+	errs := []error{}
+	for i, destination := range f.destinations {
+		err := destination.Notifier.Notify(ctx, data)
+		if err == nil {
+			if i > 0 {
+				logger.Info("Alert delivered to fallback", logging.NotifierKey, destination.Name)
+			}
+			return nil
+		}
+		names = append(names, destination.Name)
+		errs = append(errs, err)
+
+		if i == len(f.destinations)-1 || ctx.Err() != nil || !slices.Contains(f.classes, errorClass(err)) {
+			break
+		}
+		logger.Warn("Alert not delivered, falling back", logging.NotifierKey, destination.Name, "fallback", f.destinations[i+1].Name, logging.Error(err))
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return NewErrFallback(names, errs)
+}
+
+// errorClass returns the class of a delivery error, or of the first error
+// with a class it wraps, or an empty string when it has none.
+func errorClass(err error) string {
+	var errNotAvailable ErrNotAvailable
+	var errHTTPError ErrHTTPError
+	var errCircuitOpen ErrCircuitOpen
+	switch {
+	case errors.As(err, &errNotAvailable):
+		return NotAvailableClass
+	case errors.As(err, &errHTTPError):
+		return HTTPErrorClass
+	case errors.As(err, &errCircuitOpen):
+		return CircuitOpenClass
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_fallbackNotifier(t *testing.T) {
+	notAvailable := NewErrNotAvailable("http://gotify", "timeout")
+	rejected := NewErrHTTPError(http.StatusBadRequest, "Bad Request")
+	tests := []struct {
+		name      string
+		classes   []string
+		errs      []error
+		wantCalls []int
+		wantErr   bool
+	}{
+		{"primary delivered", nil, []error{nil, nil, nil}, []int{1, 0, 0}, false},
+		{"first fallback delivered", nil, []error{notAvailable, nil, nil}, []int{1, 1, 0}, false},
+		{"second fallback delivered", nil, []error{NewErrCircuitOpen("gotify"), rejected, nil}, []int{1, 1, 1}, false},
+		{"all failed", nil, []error{notAvailable, notAvailable, rejected}, []int{1, 1, 1}, true},
+		{"class not triggering", []string{NotAvailableClass}, []error{rejected, nil, nil}, []int{1, 0, 0}, true},
+		{"internal error", nil, []error{errors.New("template error"), nil, nil}, []int{1, 0, 0}, true},
+		{"wrapped error", nil, []error{fmt.Errorf("retries exhausted: %w", notAvailable), nil, nil}, []int{1, 1, 0}, false},
+	}
+
+	for _, test := range tests {
+		gotify := &fakeNotifier{err: test.errs[0]}
+		ntfy := &fakeNotifier{err: test.errs[1]}
+		webhook := &fakeNotifier{err: test.errs[2]}
+		f := NewFallback(test.classes, Destination{"gotify", gotify}, Destination{"ntfy", ntfy}, Destination{"webhook", webhook})
+
+		err := f.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Error was incorrect, want error: %t, but got: %v", test.name, test.wantErr, err)
+		}
+		calls := []int{gotify.calls, ntfy.calls, webhook.calls}
+		if !reflect.DeepEqual(test.wantCalls, calls) {
+			t.Errorf("%s: Calls were incorrect want: %+v, but got: %+v", test.name, test.wantCalls, calls)
+		}
+	}
+}
+
+func Test_fallbackNotifier_errors(t *testing.T) {
+	gotify := &fakeNotifier{err: NewErrNotAvailable("http://gotify", "timeout")}
+	ntfy := &fakeNotifier{err: NewErrHTTPError(http.StatusBadGateway, "Bad Gateway")}
+	f := NewFallback(nil, Destination{"gotify", gotify}, Destination{"ntfy", ntfy})
+
+	err := f.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	fallbackErr, ok := err.(ErrFallback)
+	if !ok {
+		t.Fatalf("Error was incorrect want: ErrFallback, but got: %#v", err)
+	}
+	if len(fallbackErr.Unwrap()) != 2 {
+		t.Errorf("Number of wrapped errors was incorrect want: 2, but got: %d", len(fallbackErr.Unwrap()))
+	}
+	want := "delivery failed for gotify and its fallbacks: gotify: notifier http://gotify not available: timeout; ntfy: destination returned and error. Code: 502 Reason: Bad Gateway"
+	if err.Error() != want {
+		t.Errorf("Error message was incorrect want: %s, but got: %s", want, err.Error())
+	}
+}
+
+func Test_newRouting_fallback(t *testing.T) {
+	configs := []Config{
+		{Name: "desktop", Type: GotifyType, Gotify: GotifyConfig{Token: "token"}, Fallback: FallbackConfig{Notifiers: []string{"phones"}, On: []string{NotAvailableClass}}},
+		{Name: "phones", Type: NTFYType, Fallback: FallbackConfig{Notifiers: []string{"desktop"}}},
+	}
+
+	routing, err := NewRouting(configs, nil, nil, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing: %s", err)
+	}
+
+	desktop := routing.Router.(*multiNotifier).destinations[0].Notifier.(*fallbackNotifier)
+	if _, ok := client(desktop.destinations[1].Notifier).(*ntfyClient); !ok {
+		t.Errorf("Fallback should deliver to the phones notifier without its fallbacks, but got: %#v", desktop.destinations[1].Notifier)
+	}
+	if !reflect.DeepEqual(desktop.classes, []string{NotAvailableClass}) {
+		t.Errorf("Fallback classes were incorrect want: %+v, but got: %+v", []string{NotAvailableClass}, desktop.classes)
+	}
+}
+
+func Test_newRouting_invalidFallback(t *testing.T) {
+	expectedErrors := []string{
+		`notifier desktop: invalid fallback error class "timeout", must be one of not_available, http_error, circuit_open`,
+		"notifier phones: unknown fallback notifier pager",
+		"notifier phones: notifier can't be its own fallback",
+	}
+
+	configs := []Config{
+		{Name: "desktop", Type: GotifyType, Gotify: GotifyConfig{Token: "token"}, Fallback: FallbackConfig{Notifiers: []string{"phones"}, On: []string{"timeout"}}},
+		{Name: "phones", Type: NTFYType, Fallback: FallbackConfig{Notifiers: []string{"pager", "phones"}}},
+	}
+
+	_, err := NewRouting(configs, nil, nil, alertmanager.DefaultTemplate())
+	if err == nil {
+		t.Fatalf("Expected an error creating an invalid routing")
+	}
+
+	actualErrors := strings.Split(err.Error(), "\n")
+	if !reflect.DeepEqual(expectedErrors, actualErrors) {
+		t.Errorf("Errors were incorrect want: %+v, but got: %+v", expectedErrors, actualErrors)
+	}
+}
@@ -2,11 +2,11 @@ package notifier
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	urlPkg "net/url"
 	"os"
 	"strconv"
 	"time"
@@ -21,10 +21,48 @@ const (
 	gotifyDefaultPriorityEnvVariable = "GOTIFY_DEFAULT_PRIORITY"
 )
 
+// GotifyConfig configures a gotify notifier. Fields not set are taken from
+// the environment variables.
+type GotifyConfig struct {
+	URL           string `yaml:"url"`
+	Token         string `yaml:"token"`
+	TimeoutMillis int    `yaml:"timeout_millis"`
+	// DefaultPriority is a pointer because 0 is a valid gotify priority.
+	DefaultPriority *int `yaml:"default_priority"`
+}
+
+func (c *GotifyConfig) setDefaults() error {
+	errs := []error{}
+	if len(c.URL) == 0 {
+		c.URL = getGotifyURLEnvVariable()
+	}
+	if len(c.Token) == 0 {
+		c.Token = getGotifyTokenEnvVariable()
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getGotifyTimeoutMillisEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	if c.DefaultPriority == nil {
+		defaultPriority, err := getGotifyDefaultPriorityEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.DefaultPriority = &defaultPriority
+	}
+	return errors.Join(errs...)
+}
+
 type gotifyClient struct {
+	baseURL         string
 	url             string
 	token           string
 	defaultPriority int
+	template        *alertmanager.Template
+	timeout         time.Duration
 
 	httpClient http.Client
 }
@@ -35,25 +73,38 @@ type gotifyMessage struct {
 	Priority int    `json:"priority"`
 }
 
-func newGotifyClient() *gotifyClient {
-	urlJoined, _ := urlPkg.JoinPath(getGotifyURLEnvVariable(), "message")
-	url, err := urlPkg.ParseRequestURI(urlJoined)
+// newGotifyClient returns a gotify client configured with config. All the
+// problems found in the configuration are returned at once.
+func newGotifyClient(config GotifyConfig, template *alertmanager.Template) (*gotifyClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
 	if err != nil {
-		log.Fatalf("new gotify client: %s", err)
+		errs = append(errs, err)
 	}
 
-	token := getGotifyTokenEnvVariable()
-	timeoutMillis := getGotifyTimeoutMillisEnvVariable()
-	defaultPriority := getGotifyDefaultPriorityEnvVariable()
-
-	httpClient := http.Client{
-		Timeout: time.Duration(timeoutMillis) * time.Millisecond,
+	url, err := joinURL(config.URL, "message")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid gotify url: %s", err))
 	}
-	return &gotifyClient{url.String(), token, defaultPriority, httpClient}
+	if len(config.Token) == 0 {
+		errs = append(errs, fmt.Errorf("gotify token is required"))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid gotify timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	timeout := time.Duration(config.TimeoutMillis) * time.Millisecond
+	return &gotifyClient{config.URL, url, config.Token, *config.DefaultPriority, template, timeout, newHTTPClient()}, nil
 }
 
-func (g *gotifyClient) Notify(alert alertmanager.Alert) error {
-	title, message, priority := alertmanager.ParseAlert(alert, g.defaultPriority)
+func (g *gotifyClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, priority, err := alertmanager.ParseAlert(data, g.template, g.defaultPriority)
+	if err != nil {
+		return err
+	}
 
 	gm := gotifyMessage{Title: title, Message: message, Priority: priority}
 
@@ -62,7 +113,10 @@ func (g *gotifyClient) Notify(alert alertmanager.Alert) error {
 		return fmt.Errorf("could not marshal gotify message: %s", err)
 	}
 
-	request, err := http.NewRequest(http.MethodPost, g.url, bytes.NewBuffer(messageBytes))
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewBuffer(messageBytes))
 	if err != nil {
 		return fmt.Errorf("error creating request: %s", err)
 	}
@@ -73,13 +127,42 @@ func (g *gotifyClient) Notify(alert alertmanager.Alert) error {
 	if err != nil {
 		return NewErrNotAvailable(g.url, err.Error())
 	} else {
+		defer resp.Body.Close()
 		if resp.StatusCode >= http.StatusBadRequest {
-			return NewErrHTTPError(resp.StatusCode, http.StatusText(resp.StatusCode))
+			return newErrHTTPErrorFromResponse(resp, "", 0)
 		}
 	}
 	return nil
 }
 
+// Probe checks gotify is healthy and accepts the token. Gotify answers the
+// token check with 401 or 403 when it rejects the token, any other answer
+// means it was accepted.
+func (g *gotifyClient) Probe(ctx context.Context) error {
+	healthURL, err := joinURL(g.baseURL, "health")
+	if err != nil {
+		return err
+	}
+	err = get(ctx, &g.httpClient, g.timeout, healthURL, nil)
+	if err != nil {
+		return err
+	}
+
+	applicationURL, err := joinURL(g.baseURL, "current", "application")
+	if err != nil {
+		return err
+	}
+	err = get(ctx, &g.httpClient, g.timeout, applicationURL, http.Header{"X-Gotify-Key": {g.token}})
+	var e ErrHTTPError
+	if errors.As(err, &e) && e.Code() != http.StatusUnauthorized && e.Code() != http.StatusForbidden {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("gotify token rejected: %s", err)
+	}
+	return nil
+}
+
 func getGotifyURLEnvVariable() string {
 	value := os.Getenv(gotifyURLEnvVariable)
 	if len(value) != 0 {
@@ -89,33 +172,29 @@ func getGotifyURLEnvVariable() string {
 }
 
 func getGotifyTokenEnvVariable() string {
-	gotifyToken := os.Getenv(gotifyTokenEnvVariable)
-	if len(gotifyToken) == 0 {
-		log.Fatalf("Gotify token is required")
-	}
-	return gotifyToken
+	return os.Getenv(gotifyTokenEnvVariable)
 }
 
-func getGotifyTimeoutMillisEnvVariable() int {
+func getGotifyTimeoutMillisEnvVariable() (int, error) {
 	value := os.Getenv(gotifyTimeoutMillisEnvVariable)
 	if len(value) != 0 {
 		timeout, err := strconv.Atoi(value)
 		if err != nil || timeout < 1 {
-			log.Fatal("Invalid gotify timeout. Must be a number greater than 0")
+			return 0, fmt.Errorf("invalid %s %q, must be a number greater than 0", gotifyTimeoutMillisEnvVariable, value)
 		}
-		return timeout
+		return timeout, nil
 	}
-	return 5000
+	return 5000, nil
 }
 
-func getGotifyDefaultPriorityEnvVariable() int {
+func getGotifyDefaultPriorityEnvVariable() (int, error) {
 	value := os.Getenv(gotifyDefaultPriorityEnvVariable)
 	if len(value) != 0 {
 		defaultPriorityInt, err := strconv.Atoi(value)
 		if err != nil {
-			log.Fatalln("Invalid default priority value")
+			return 0, fmt.Errorf("invalid %s %q, must be a number", gotifyDefaultPriorityEnvVariable, value)
 		}
-		return defaultPriorityInt
+		return defaultPriorityInt, nil
 	}
-	return 5
+	return 5, nil
 }
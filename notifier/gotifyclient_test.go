@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_getGotifyTimeoutMillisEnvVariable_badValue(t *testing.T) {
+	os.Setenv(gotifyTimeoutMillisEnvVariable, "bad")
+
+	_, err := getGotifyTimeoutMillisEnvVariable()
+
+	if err == nil {
+		t.Errorf("Expected an error for an invalid timeout")
+	}
+	os.Unsetenv(gotifyTimeoutMillisEnvVariable)
+}
+
+func Test_newGotifyClient_envDefaults(t *testing.T) {
+	expectedURL := "http://gotify:8080/message"
+	expectedToken := "token"
+	expectedDefaultPriority := 0
+
+	os.Setenv(gotifyURLEnvVariable, "http://gotify:8080")
+	os.Setenv(gotifyTokenEnvVariable, "env-token")
+
+	defaultPriority := 0
+	client, err := newGotifyClient(GotifyConfig{Token: "token", DefaultPriority: &defaultPriority}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	if expectedURL != client.url {
+		t.Errorf("URL was incorrect want: %+v, but got: %+v", expectedURL, client.url)
+	}
+	if expectedToken != client.token {
+		t.Errorf("Token was incorrect want: %+v, but got: %+v", expectedToken, client.token)
+	}
+	if expectedDefaultPriority != client.defaultPriority {
+		t.Errorf("Default priority was incorrect want: %+v, but got: %+v", expectedDefaultPriority, client.defaultPriority)
+	}
+	os.Unsetenv(gotifyURLEnvVariable)
+	os.Unsetenv(gotifyTokenEnvVariable)
+}
+
+func Test_newGotifyClient_invalidURL(t *testing.T) {
+	_, err := newGotifyClient(GotifyConfig{URL: "not a url", Token: "token"}, alertmanager.DefaultTemplate())
+
+	if err == nil {
+		t.Errorf("Expected an error for an invalid url")
+	}
+}
@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"context"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/metrics"
+	"github.com/dcasado/alertmanager-notifier/tracing"
+)
+
+// internalClass is the error class reported in the metrics for the errors
+// without class, like errors rendering the templates.
+const internalClass = "internal"
+
+// countedNotifier counts the deliveries of a notifier that succeed and fail.
+type countedNotifier struct {
+	name     string
+	notifier Notifier
+}
+
+func newCountedNotifier(name string, n Notifier) Notifier {
+	return &countedNotifier{name: name, notifier: n}
+}
+
+func (c *countedNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	err := c.notifier.Notify(ctx, data)
+	if err != nil {
+		class := errorClass(err)
+		if len(class) == 0 {
+			class = internalClass
+		}
+		metrics.NotificationsFailed.WithLabelValues(c.name, class).Inc()
+	} else {
+		metrics.NotificationsSent.WithLabelValues(c.name).Inc()
+	}
+	return err
+}
+
+// timedNotifier observes the time taken by each delivery of a notifier to
+// its destination.
+type timedNotifier struct {
+	name     string
+	notifier Notifier
+}
+
+func newTimedNotifier(name string, n Notifier) Notifier {
+	return &timedNotifier{name: name, notifier: n}
+}
+
+func (t *timedNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	start := time.Now()
+	err := t.notifier.Notify(ctx, data)
+	metrics.BackendDuration.WithLabelValues(t.name).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// tracedNotifier traces the deliveries of a notifier with a span of the
+// given name.
+type tracedNotifier struct {
+	spanName string
+	name     string
+	notifier Notifier
+}
+
+func newTracedNotifier(spanName string, name string, n Notifier) Notifier {
+	return &tracedNotifier{spanName: spanName, name: name, notifier: n}
+}
+
+func (t *tracedNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	ctx, span := tracing.Start(ctx, t.spanName, tracing.NotifierKey.String(t.name))
+	err := t.notifier.Notify(ctx, data)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,132 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/metrics"
+	"github.com/dcasado/alertmanager-notifier/tracing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_countedNotifier(t *testing.T) {
+	n := &sequenceNotifier{errs: []error{NewErrNotAvailable("http://gotify", "timeout"), errors.New("template error"), NewErrHTTPError(http.StatusBadRequest, "Bad Request")}}
+	counted := newCountedNotifier("counted", n)
+	for range 4 {
+		counted.Notify(context.Background(), &alertmanager.Data{})
+	}
+
+	tests := []struct {
+		class string
+		want  float64
+	}{
+		{NotAvailableClass, 1},
+		{HTTPErrorClass, 1},
+		{internalClass, 1},
+		{CircuitOpenClass, 0},
+	}
+	for _, test := range tests {
+		got := testutil.ToFloat64(metrics.NotificationsFailed.WithLabelValues("counted", test.class))
+		if got != test.want {
+			t.Errorf("Failed notifications of class %s were incorrect want: %+v, but got: %+v", test.class, test.want, got)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.NotificationsSent.WithLabelValues("counted")); got != 1 {
+		t.Errorf("Sent notifications were incorrect want: %+v, but got: %+v", 1, got)
+	}
+}
+
+func Test_timedNotifier(t *testing.T) {
+	timed := newTimedNotifier("timed", &sequenceNotifier{errs: []error{NewErrNotAvailable("http://gotify", "timeout")}})
+	timed.Notify(context.Background(), &alertmanager.Data{})
+	timed.Notify(context.Background(), &alertmanager.Data{})
+
+	if got := testutil.CollectAndCount(metrics.BackendDuration, "alertmanager_notifier_backend_request_duration_seconds"); got == 0 {
+		t.Errorf("Backend request duration should be observed")
+	}
+}
+
+func Test_retryNotifier_metrics(t *testing.T) {
+	notAvailable := NewErrNotAvailable("http://ntfy", "timeout")
+	r := NewRetry("retried", &sequenceNotifier{errs: []error{notAvailable, notAvailable}}, testRetryConfig(4))
+	r.Notify(context.Background(), &alertmanager.Data{})
+
+	if got := testutil.ToFloat64(metrics.Retries.WithLabelValues("retried")); got != 2 {
+		t.Errorf("Retries were incorrect want: %+v, but got: %+v", 2, got)
+	}
+}
+
+func Test_tracedNotifier(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracing.NewProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	n, _, _, err := newNotifier(Config{Name: "ops", Type: GotifyType, Gotify: GotifyConfig{URL: server.URL, Token: "token"}}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating notifier: %s", err)
+	}
+	n.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Spans were incorrect want: 3, but got: %d", len(spans))
+	}
+	request, attempt, delivery := spans[0], spans[1], spans[2]
+	if delivery.Name != "notifier" || attempt.Name != "notifier attempt" {
+		t.Errorf("Span names were incorrect want: notifier and notifier attempt, but got: %s and %s", delivery.Name, attempt.Name)
+	}
+	if attempt.Parent.SpanID() != delivery.SpanContext.SpanID() || request.Parent.SpanID() != attempt.SpanContext.SpanID() {
+		t.Errorf("Request span should be a child of the attempt span, child of the delivery span")
+	}
+	if delivery.Status.Description != NewErrHTTPError(http.StatusBadGateway, "Bad Gateway").Error() {
+		t.Errorf("Delivery span should record the error, got status: %+v", delivery.Status)
+	}
+	if !strings.Contains(traceparent, delivery.SpanContext.TraceID().String()) {
+		t.Errorf("Trace context should be propagated to the destination, got traceparent: %q", traceparent)
+	}
+}
+
+// recordSpans records the spans ended during the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracing.NewProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+// checkSpansWithoutSecret checks there are request spans and none of the
+// recorded spans has an attribute containing secret.
+func checkSpansWithoutSecret(t *testing.T, exporter *tracetest.InMemoryExporter, secret string) {
+	t.Helper()
+	requests := 0
+	for _, span := range exporter.GetSpans() {
+		if strings.HasPrefix(span.Name, "HTTP ") {
+			requests++
+		}
+		for _, attribute := range span.Attributes {
+			if strings.Contains(attribute.Value.Emit(), secret) {
+				t.Errorf("Attribute %s of span %s should not contain the secret, got: %s", attribute.Key, span.Name, attribute.Value.Emit())
+			}
+		}
+	}
+	if requests == 0 {
+		t.Errorf("Requests to the destination should be traced")
+	}
+}
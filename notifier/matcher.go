@@ -0,0 +1,89 @@
+package notifier
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+// MatchType is the comparison done by a matcher.
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+var matcherRegexp = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+
+// Matcher matches the value of an alert label, following the semantics of
+// Alertmanager matchers: a missing label has an empty value and regular
+// expressions are fully anchored.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+
+	re *regexp.Regexp
+}
+
+// ParseMatcher parses a matcher like `team=db` or `severity=~"critical|page"`.
+func ParseMatcher(text string) (*Matcher, error) {
+	groups := matcherRegexp.FindStringSubmatch(text)
+	if groups == nil {
+		return nil, fmt.Errorf("invalid matcher %q", text)
+	}
+
+	value := groups[3]
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %q: bad quoted value", text)
+		}
+		value = unquoted
+	}
+	return NewMatcher(groups[1], MatchType(groups[2]), value)
+}
+
+// NewMatcher returns a matcher comparing the label name with value.
+func NewMatcher(name string, matchType MatchType, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Type: matchType, Value: value}
+	switch matchType {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher regular expression %q: %s", value, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("invalid match type %q", matchType)
+	}
+	return m, nil
+}
+
+// Matches returns whether the labels satisfy the matcher.
+func (m *Matcher) Matches(labels alertmanager.KV) bool {
+	value := labels[m.Name]
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
@@ -0,0 +1,61 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_parseMatcher(t *testing.T) {
+	tests := map[string]Matcher{
+		"team=db":                   {Name: "team", Type: MatchEqual, Value: "db"},
+		"team != db":                {Name: "team", Type: MatchNotEqual, Value: "db"},
+		`severity=~"critical|page"`: {Name: "severity", Type: MatchRegexp, Value: "critical|page"},
+		"instance!~db-.*":           {Name: "instance", Type: MatchNotRegexp, Value: "db-.*"},
+		`summary="a=b, \"quoted\""`: {Name: "summary", Type: MatchEqual, Value: `a=b, "quoted"`},
+	}
+
+	for text, expected := range tests {
+		actual, err := ParseMatcher(text)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing matcher %s: %s", text, err)
+		}
+		if expected.Name != actual.Name || expected.Type != actual.Type || expected.Value != actual.Value {
+			t.Errorf("Matcher was incorrect want: %+v, but got: %+v", expected, actual)
+		}
+	}
+}
+
+func Test_parseMatcher_invalid(t *testing.T) {
+	for _, text := range []string{"team", "=db", "team=~(", `team="db`} {
+		_, err := ParseMatcher(text)
+		if err == nil {
+			t.Errorf("Expected an error parsing matcher %s", text)
+		}
+	}
+}
+
+func Test_matcherMatches(t *testing.T) {
+	labels := alertmanager.KV{"team": "db", "severity": "critical"}
+
+	tests := map[string]bool{
+		"team=db":                 true,
+		"team=web":                false,
+		"team!=web":               true,
+		"severity=~critical|page": true,
+		"severity=~crit":          false,
+		"severity!~warning":       true,
+		"missing=":                true,
+		"missing!=":               false,
+	}
+
+	for text, expected := range tests {
+		matcher, err := ParseMatcher(text)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing matcher %s: %s", text, err)
+		}
+		if actual := matcher.Matches(labels); expected != actual {
+			t.Errorf("Match of %s was incorrect want: %+v, but got: %+v", text, expected, actual)
+		}
+	}
+}
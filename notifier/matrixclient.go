@@ -0,0 +1,287 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const (
+	matrixURLEnvVariable           = "MATRIX_URL"
+	matrixAccessTokenEnvVariable   = "MATRIX_ACCESS_TOKEN"
+	matrixRoomIDEnvVariable        = "MATRIX_ROOM_ID"
+	matrixMsgTypeEnvVariable       = "MATRIX_MSGTYPE"
+	matrixTimeoutMillisEnvVariable = "MATRIX_TIMEOUT_MILLIS"
+)
+
+// Message types of the matrix messages.
+const (
+	MatrixText   string = "m.text"
+	MatrixNotice string = "m.notice"
+)
+
+const (
+	matrixHTMLFormat = "org.matrix.custom.html"
+	// matrixMaxMessageLength keeps the events well under the 65536 bytes
+	// limit of matrix, with both the plain and the HTML body.
+	matrixMaxMessageLength = 16000
+)
+
+// MatrixConfig configures a matrix notifier. Fields not set are taken from
+// the environment variables.
+type MatrixConfig struct {
+	// URL is the base URL of the homeserver of the user sending the messages.
+	URL string `yaml:"url"`
+	// AccessToken is the access token of the user sending the messages.
+	AccessToken string `yaml:"access_token"`
+	// RoomID is the id of the room messages are sent to, e.g.
+	// !abcdefgh:matrix.org. The user must have joined it.
+	RoomID string `yaml:"room_id"`
+	// MsgType is the type of the messages: m.text or m.notice, which
+	// clients usually show without notifying.
+	MsgType       string `yaml:"msgtype"`
+	TimeoutMillis int    `yaml:"timeout_millis"`
+}
+
+func (c *MatrixConfig) setDefaults() error {
+	if len(c.URL) == 0 {
+		c.URL = os.Getenv(matrixURLEnvVariable)
+	}
+	if len(c.AccessToken) == 0 {
+		c.AccessToken = os.Getenv(matrixAccessTokenEnvVariable)
+	}
+	if len(c.RoomID) == 0 {
+		c.RoomID = os.Getenv(matrixRoomIDEnvVariable)
+	}
+	if len(c.MsgType) == 0 {
+		c.MsgType = getMatrixMsgTypeEnvVariable()
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getMatrixTimeoutMillisEnvVariable()
+		if err != nil {
+			return err
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	return nil
+}
+
+type matrixClient struct {
+	baseURL     string
+	accessToken string
+	roomID      string
+	msgType     string
+	template    *alertmanager.Template
+	timeout     time.Duration
+
+	httpClient http.Client
+}
+
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// matrixResponse is the body of the matrix responses.
+type matrixResponse struct {
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMs int    `json:"retry_after_ms"`
+}
+
+// newMatrixClient returns a matrix client configured with config. All the
+// problems found in the configuration are returned at once.
+func newMatrixClient(config MatrixConfig, template *alertmanager.Template) (*matrixClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(config.URL) == 0 {
+		errs = append(errs, fmt.Errorf("matrix url is required"))
+	} else if _, err := joinURL(config.URL, "_matrix"); err != nil {
+		errs = append(errs, fmt.Errorf("invalid matrix url: %s", err))
+	}
+	if len(config.AccessToken) == 0 {
+		errs = append(errs, fmt.Errorf("matrix access token is required"))
+	}
+	if !strings.HasPrefix(config.RoomID, "!") {
+		errs = append(errs, fmt.Errorf("invalid matrix room id %q, must be a room id like !abcdefgh:matrix.org", config.RoomID))
+	}
+	if config.MsgType != MatrixText && config.MsgType != MatrixNotice {
+		errs = append(errs, fmt.Errorf("invalid matrix msgtype %q, must be %s or %s", config.MsgType, MatrixText, MatrixNotice))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid matrix timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &matrixClient{
+		baseURL:     config.URL,
+		accessToken: config.AccessToken,
+		roomID:      config.RoomID,
+		msgType:     config.MsgType,
+		template:    template,
+		timeout:     time.Duration(config.TimeoutMillis) * time.Millisecond,
+		httpClient:  newHTTPClient(),
+	}, nil
+}
+
+// Notify sends the message to the room. The transaction id is derived from
+// the alert, so when a retry sends a message the homeserver already received
+// it is not shown twice.
+func (m *matrixClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, err := m.template.Render(data)
+	if err != nil {
+		return err
+	}
+
+	url, err := joinURL(m.baseURL, "_matrix", "client", "v3", "rooms", m.roomID, "send", "m.room.message", matrixTransactionID(m.roomID, data))
+	if err != nil {
+		return fmt.Errorf("invalid matrix url: %s", err)
+	}
+	return m.do(ctx, http.MethodPut, url, m.message(data, title, message), nil)
+}
+
+// message returns the message with the title followed by the message and the
+// link to the source of the alert, if any, both as plain text and as HTML.
+func (m *matrixClient) message(data *alertmanager.Data, title string, message string) matrixMessage {
+	title = truncate(title, matrixMaxMessageLength)
+	message = truncate(message, max(matrixMaxMessageLength-len([]rune(title))-1, 1))
+
+	body := fmt.Sprintf("%s\n%s", title, message)
+	formattedBody := fmt.Sprintf("<strong>%s</strong><br>%s", html.EscapeString(title), strings.ReplaceAll(html.EscapeString(message), "\n", "<br>"))
+	if len(data.GeneratorURL) != 0 {
+		body += "\nSource: " + data.GeneratorURL
+		formattedBody += fmt.Sprintf(`<br><a href="%s">Source</a>`, html.EscapeString(data.GeneratorURL))
+	}
+	return matrixMessage{MsgType: m.msgType, Body: body, Format: matrixHTMLFormat, FormattedBody: formattedBody}
+}
+
+// matrixTransactionID returns the transaction id of the message of the alert
+// sent to the room. It is the same for every delivery of the same alert
+// status, identified by its fingerprint, or its labels when it has none, and
+// its start.
+func matrixTransactionID(roomID string, data *alertmanager.Data) string {
+	identity := data.Fingerprint
+	if len(identity) == 0 {
+		labels, _ := json.Marshal(data.Labels)
+		identity = string(labels)
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%s|%s|%s", roomID, identity, data.Status, data.StartsAt.Format(time.RFC3339Nano)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Probe checks the homeserver accepts the access token and the user has
+// joined the room.
+func (m *matrixClient) Probe(ctx context.Context) error {
+	url, err := joinURL(m.baseURL, "_matrix", "client", "v3", "joined_rooms")
+	if err != nil {
+		return fmt.Errorf("invalid matrix url: %s", err)
+	}
+	var response struct {
+		JoinedRooms []string `json:"joined_rooms"`
+	}
+	err = m.do(ctx, http.MethodGet, url, nil, &response)
+	if err != nil {
+		return err
+	}
+	for _, room := range response.JoinedRooms {
+		if room == m.roomID {
+			return nil
+		}
+	}
+	return fmt.Errorf("matrix room %s not joined", m.roomID)
+}
+
+// do makes a request to the client-server API with the body, if any, and
+// decodes the response into result, if any.
+func (m *matrixClient) do(ctx context.Context, method string, url string, body any, result any) error {
+	var content io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not marshal matrix request: %s", err)
+		}
+		content = bytes.NewReader(encoded)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, url, content)
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+m.accessToken)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.httpClient.Do(request)
+	if err != nil {
+		return NewErrNotAvailable(url, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newMatrixError(resp)
+	}
+	if result != nil {
+		err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(result)
+		if err != nil {
+			return fmt.Errorf("could not decode matrix response: %s", err)
+		}
+	}
+	return nil
+}
+
+// newMatrixError returns the error for a failed response, with the error code
+// and the delay to retry reported by matrix in its body, if any.
+func newMatrixError(resp *http.Response) error {
+	var body matrixResponse
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(content, &body)
+	msg := ""
+	if len(body.ErrCode) != 0 {
+		msg = strings.TrimSuffix(fmt.Sprintf("%s: %s", body.ErrCode, body.Error), ": ")
+	}
+	return newErrHTTPErrorFromResponse(resp, msg, time.Duration(body.RetryAfterMs)*time.Millisecond)
+}
+
+func getMatrixMsgTypeEnvVariable() string {
+	value := os.Getenv(matrixMsgTypeEnvVariable)
+	if len(value) != 0 {
+		return value
+	}
+	return MatrixText
+}
+
+func getMatrixTimeoutMillisEnvVariable() (int, error) {
+	value := os.Getenv(matrixTimeoutMillisEnvVariable)
+	if len(value) != 0 {
+		timeout, err := strconv.Atoi(value)
+		if err != nil || timeout < 1 {
+			return 0, fmt.Errorf("invalid %s %q, must be a number greater than 0", matrixTimeoutMillisEnvVariable, value)
+		}
+		return timeout, nil
+	}
+	return 5000, nil
+}
@@ -0,0 +1,174 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const matrixTestRoomID = "!abcdefgh:matrix.org"
+
+type matrixRequest struct {
+	method        string
+	path          string
+	authorization string
+	message       matrixMessage
+}
+
+// matrixServer is a matrix homeserver stand-in recording the requests it
+// receives and answering them with respond.
+func matrixServer(t *testing.T, respond func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, chan matrixRequest) {
+	requests := make(chan matrixRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message matrixMessage
+		if r.Method == http.MethodPut {
+			err := json.NewDecoder(r.Body).Decode(&message)
+			if err != nil {
+				t.Errorf("Unexpected error decoding the request: %s", err)
+			}
+		}
+		requests <- matrixRequest{method: r.Method, path: r.URL.Path, authorization: r.Header.Get("Authorization"), message: message}
+		respond(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func respondMatrixEvent(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`{"event_id":"$event"}`))
+}
+
+func newTestMatrixClient(t *testing.T, url string) *matrixClient {
+	client, err := newMatrixClient(MatrixConfig{URL: url, AccessToken: "secret", RoomID: matrixTestRoomID}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+	return client
+}
+
+func Test_newMatrixClient_invalidConfig(t *testing.T) {
+	_, err := newMatrixClient(MatrixConfig{RoomID: "#alerts:matrix.org", MsgType: "m.emote"}, alertmanager.DefaultTemplate())
+
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid configuration")
+	}
+	for _, want := range []string{"url is required", "access token is required", "room id \"#alerts:matrix.org\"", "msgtype \"m.emote\""} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error should contain %q, got: %s", want, err)
+		}
+	}
+}
+
+func Test_matrixClientNotify(t *testing.T) {
+	server, requests := matrixServer(t, respondMatrixEvent)
+	client := newTestMatrixClient(t, server.URL)
+
+	alert := alertmanager.Alert{
+		Status:       "firing",
+		Labels:       alertmanager.KV{"alertname": "Disk_Full"},
+		Annotations:  alertmanager.KV{"description": "Usage is <95%>\non /data"},
+		StartsAt:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		GeneratorURL: "https://prometheus/graph?g0.expr=up&g0.tab=1",
+		Fingerprint:  "abc123",
+	}
+	err := client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	request := <-requests
+	wantPath := "/_matrix/client/v3/rooms/" + matrixTestRoomID + "/send/m.room.message/" + matrixTransactionID(matrixTestRoomID, alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if request.method != http.MethodPut || request.path != wantPath {
+		t.Errorf("Request was incorrect want: PUT %+v, but got: %s %+v", wantPath, request.method, request.path)
+	}
+	if request.authorization != "Bearer secret" {
+		t.Errorf("Authorization was incorrect want: %+v, but got: %+v", "Bearer secret", request.authorization)
+	}
+	message := request.message
+	if message.MsgType != MatrixText || message.Format != matrixHTMLFormat {
+		t.Errorf("Message type was incorrect want: %s and %s, but got: %s and %s", MatrixText, matrixHTMLFormat, message.MsgType, message.Format)
+	}
+	if !strings.Contains(message.Body, "Usage is <95%>\non /data") || !strings.HasSuffix(message.Body, "\nSource: "+alert.GeneratorURL) {
+		t.Errorf("Body should be the plain message with the source, got: %q", message.Body)
+	}
+	if !strings.Contains(message.FormattedBody, "Usage is &lt;95%&gt;<br>on /data") || !strings.HasSuffix(message.FormattedBody, `<a href="https://prometheus/graph?g0.expr=up&amp;g0.tab=1">Source</a>`) {
+		t.Errorf("Formatted body should be the escaped message with the source link, got: %q", message.FormattedBody)
+	}
+}
+
+func Test_matrixTransactionID(t *testing.T) {
+	alert := alertmanager.Alert{Status: "firing", Labels: alertmanager.KV{"alertname": "Disk_Full"}, Fingerprint: "abc123", StartsAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	id := matrixTransactionID(matrixTestRoomID, alertmanager.NewData(alertmanager.RequestBody{}, alert))
+
+	if again := matrixTransactionID(matrixTestRoomID, alertmanager.NewData(alertmanager.RequestBody{}, alert)); again != id {
+		t.Errorf("Transaction id should be the same for the same alert want: %+v, but got: %+v", id, again)
+	}
+
+	resolved := alert
+	resolved.Status = "resolved"
+	refired := alert
+	refired.StartsAt = alert.StartsAt.Add(time.Hour)
+	other := alert
+	other.Fingerprint = "def456"
+	unfingerprinted := alert
+	unfingerprinted.Fingerprint = ""
+	for _, changed := range []alertmanager.Alert{resolved, refired, other, unfingerprinted} {
+		if changedID := matrixTransactionID(matrixTestRoomID, alertmanager.NewData(alertmanager.RequestBody{}, changed)); changedID == id {
+			t.Errorf("Transaction id should change for %+v", changed)
+		}
+	}
+	if otherRoom := matrixTransactionID("!other:matrix.org", alertmanager.NewData(alertmanager.RequestBody{}, alert)); otherRoom == id {
+		t.Errorf("Transaction id should change for another room")
+	}
+}
+
+func Test_matrixClientNotify_errors(t *testing.T) {
+	server, _ := matrixServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"errcode":"M_LIMIT_EXCEEDED","error":"Too many requests","retry_after_ms":2500}`))
+	})
+	client := newTestMatrixClient(t, server.URL)
+
+	err := client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+
+	var httpErr ErrHTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Error was incorrect want: ErrHTTPError, but got: %+v", err)
+	}
+	if httpErr.Code() != http.StatusTooManyRequests || httpErr.msg != "M_LIMIT_EXCEEDED: Too many requests" {
+		t.Errorf("Error was incorrect want: %d M_LIMIT_EXCEEDED: Too many requests, but got: %d %s", http.StatusTooManyRequests, httpErr.Code(), httpErr.msg)
+	}
+	if httpErr.RetryAfter() != 2500*time.Millisecond {
+		t.Errorf("Retry after was incorrect want: %+v, but got: %+v", 2500*time.Millisecond, httpErr.RetryAfter())
+	}
+}
+
+func Test_matrixClientProbe(t *testing.T) {
+	joinedRooms := `{"joined_rooms":["` + matrixTestRoomID + `"]}`
+	server, requests := matrixServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(joinedRooms))
+	})
+	client := newTestMatrixClient(t, server.URL)
+
+	err := client.Probe(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error probing: %s", err)
+	}
+	request := <-requests
+	if request.method != http.MethodGet || request.path != "/_matrix/client/v3/joined_rooms" || request.authorization != "Bearer secret" {
+		t.Errorf("Request was incorrect want: GET /_matrix/client/v3/joined_rooms, but got: %s %s", request.method, request.path)
+	}
+
+	joinedRooms = `{"joined_rooms":["!other:matrix.org"]}`
+	err = client.Probe(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not joined") {
+		t.Errorf("Probe should fail when the room is not joined, got: %v", err)
+	}
+}
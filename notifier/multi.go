@@ -0,0 +1,96 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+// Destination is a notifier identified by a name.
+type Destination struct {
+	Name     string
+	Notifier Notifier
+}
+
+// ErrFanOut is returned by a multi notifier when the delivery to any of its
+// destinations fails. It wraps the errors of the failed destinations.
+type ErrFanOut struct {
+	total  int
+	names  []string
+	errors []error
+}
+
+func NewErrFanOut(total int, names []string, errors []error) error {
+	return ErrFanOut{total: total, names: names, errors: errors}
+}
+
+func (e ErrFanOut) Error() string {
+	failures := make([]string, 0, len(e.errors))
+	for i, err := range e.errors {
+		failures = append(failures, fmt.Sprintf("%s: %s", e.names[i], err))
+	}
+	return fmt.Sprintf("delivery failed for %d of %d notifiers: %s", len(e.errors), e.total, strings.Join(failures, "; "))
+}
+
+func (e ErrFanOut) Unwrap() []error {
+	return e.errors
+}
+
+type multiNotifier struct {
+	destinations []Destination
+}
+
+// NewMulti returns a notifier delivering each alert to all the destinations
+// concurrently. When the delivery is tracked with WithTracking, the
+// destinations the alert was already delivered to are skipped, so a retry
+// of a partially failed alert is only delivered to the failed ones.
+func NewMulti(destinations ...Destination) Notifier {
+	return &multiNotifier{destinations: destinations}
+}
+
+func (m *multiNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	errs := make([]error, len(m.destinations))
+	skipped := make([]bool, len(m.destinations))
+
+	var wg sync.WaitGroup
+	for i, destination := range m.destinations {
+		ctx, tracking := trackDestination(ctx, destination.Name)
+		if tracking.delivered() {
+			skipped[i] = true
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = destination.Notifier.Notify(ctx, data)
+			if errs[i] == nil {
+				tracking.markDelivered()
+			}
+		}()
+	}
+	wg.Wait()
+
+	logger := logging.FromContext(ctx)
+	failedNames := []string{}
+	failedErrs := []error{}
+	for i, destination := range m.destinations {
+		if skipped[i] {
+			logger.Info("Alert already delivered, skipping it", logging.NotifierKey, destination.Name)
+		} else if errs[i] != nil {
+			logger.Warn("Alert not delivered", logging.NotifierKey, destination.Name, logging.Error(errs[i]))
+			failedNames = append(failedNames, destination.Name)
+			failedErrs = append(failedErrs, errs[i])
+		} else {
+			logger.Info("Alert delivered", logging.NotifierKey, destination.Name)
+		}
+	}
+
+	if len(failedErrs) != 0 {
+		return NewErrFanOut(len(m.destinations), failedNames, failedErrs)
+	}
+	return nil
+}
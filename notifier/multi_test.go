@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+type fakeNotifier struct {
+	err   error
+	calls int
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	f.calls++
+	return f.err
+}
+
+// fakeTracker remembers the deliveries forever.
+type fakeTracker struct {
+	mutex     sync.Mutex
+	delivered map[string]bool
+}
+
+func (f *fakeTracker) Delivered(key string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.delivered[key]
+}
+
+func (f *fakeTracker) MarkDelivered(key string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.delivered[key] = true
+}
+
+func Test_multiNotifier(t *testing.T) {
+	gotify := &fakeNotifier{}
+	ntfy := &fakeNotifier{}
+
+	m := NewMulti(Destination{"gotify", gotify}, Destination{"ntfy", ntfy})
+	err := m.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if gotify.calls != 1 || ntfy.calls != 1 {
+		t.Errorf("Every notifier should be called once, but got: %d and %d", gotify.calls, ntfy.calls)
+	}
+}
+
+func Test_multiNotifier_partialFailure(t *testing.T) {
+	expectedError := "delivery failed for 1 of 2 notifiers: ntfy: notifier http://ntfy not available: timeout"
+
+	gotify := &fakeNotifier{}
+	ntfy := &fakeNotifier{err: NewErrNotAvailable("http://ntfy", "timeout")}
+
+	m := NewMulti(Destination{"gotify", gotify}, Destination{"ntfy", ntfy})
+	err := m.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+
+	if err == nil {
+		t.Fatalf("Expected an error when a notifier fails")
+	}
+	if expectedError != err.Error() {
+		t.Errorf("Error was incorrect want: %+v, but got: %+v", expectedError, err.Error())
+	}
+	var errNotAvailable ErrNotAvailable
+	if !errors.As(err, &errNotAvailable) {
+		t.Errorf("Error should wrap the notifier error, but got: %#v", err)
+	}
+	if gotify.calls != 1 {
+		t.Errorf("Successful notifier should be called once, but got: %d", gotify.calls)
+	}
+}
+
+func Test_multiNotifier_tracking(t *testing.T) {
+	gotify := &fakeNotifier{}
+	ntfy := &fakeNotifier{err: NewErrNotAvailable("http://ntfy", "timeout")}
+	tracker := &fakeTracker{delivered: map[string]bool{}}
+	ctx := WithTracking(context.Background(), tracker, "alert")
+
+	m := NewMulti(Destination{"gotify", gotify}, Destination{"ntfy", ntfy})
+	data := alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{})
+	err := m.Notify(ctx, data)
+	if err == nil {
+		t.Fatalf("Expected an error when a notifier fails")
+	}
+
+	ntfy.err = nil
+	err = m.Notify(ctx, data)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if gotify.calls != 1 || ntfy.calls != 2 {
+		t.Errorf("Only the failed notifier should be retried, but got calls: %d and %d", gotify.calls, ntfy.calls)
+	}
+
+	err = m.Notify(ctx, data)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if gotify.calls != 1 || ntfy.calls != 2 {
+		t.Errorf("Delivered notifiers should be skipped, but got calls: %d and %d", gotify.calls, ntfy.calls)
+	}
+	if !tracker.delivered["alert|gotify"] || !tracker.delivered["alert|ntfy"] {
+		t.Errorf("Deliveries should be tracked by notifier, but got: %+v", tracker.delivered)
+	}
+}
@@ -1,15 +1,28 @@
 package notifier
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	urlPkg "net/url"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/tracing"
 )
 
 const (
-	GotifyType string = "gotify"
-	NTFYType   string = "ntfy"
+	GotifyType   string = "gotify"
+	NTFYType     string = "ntfy"
+	PushoverType string = "pushover"
+	TelegramType string = "telegram"
+	MatrixType   string = "matrix"
+	DiscordType  string = "discord"
+	SlackType    string = "slack"
+	WebhookType  string = "webhook"
 )
 
 type ErrNotAvailable struct {
@@ -26,30 +39,302 @@ func (e ErrNotAvailable) Error() string {
 }
 
 type ErrHTTPError struct {
-	code int
-	msg  string
+	code       int
+	msg        string
+	retryAfter time.Duration
 }
 
 func NewErrHTTPError(code int, msg string) error {
 	return ErrHTTPError{code: code, msg: msg}
 }
 
+// newErrHTTPErrorFromResponse returns the error for a failed response. msg is
+// the reason reported by the destination in the body, the status text when
+// empty. retryAfter is the delay requested in the body before retrying, the
+// one of the Retry-After header, if any, when 0.
+func newErrHTTPErrorFromResponse(resp *http.Response, msg string, retryAfter time.Duration) error {
+	if len(msg) == 0 {
+		msg = http.StatusText(resp.StatusCode)
+	}
+	if retryAfter <= 0 {
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return ErrHTTPError{code: resp.StatusCode, msg: msg, retryAfter: retryAfter}
+}
+
 func (e ErrHTTPError) Error() string {
 	return fmt.Sprintf("destination returned and error. Code: %d Reason: %s", e.code, e.msg)
 }
 
+// Code returns the status code returned by the destination.
+func (e ErrHTTPError) Code() int {
+	return e.code
+}
+
+// RetryAfter returns the delay the destination requested before retrying, or
+// 0 if it didn't request any.
+func (e ErrHTTPError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number
+// of seconds or an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// Notifier delivers the notification of an alert. Delivery is cancelled when
+// ctx is done.
 type Notifier interface {
-	Notify(alert alertmanager.Alert) error
+	Notify(ctx context.Context, data *alertmanager.Data) error
+}
+
+// Tracker remembers the deliveries already done, like delivery.Tracker.
+type Tracker interface {
+	Delivered(key string) bool
+	MarkDelivered(key string)
+}
+
+type trackingContextKey struct{}
+
+// tracking is the tracking of the delivery of an alert, or of the delivery
+// to one of its destinations, under key.
+type tracking struct {
+	tracker Tracker
+	key     string
 }
 
-func New(notifierType string) Notifier {
-	switch notifierType {
+// WithTracking returns a copy of ctx with which the notifiers delivering an
+// alert to several destinations remember under key, with tracker, the
+// destinations it was delivered to, so a retry of the alert skips them.
+// Tracking is disabled when key is empty.
+func WithTracking(ctx context.Context, tracker Tracker, key string) context.Context {
+	return context.WithValue(ctx, trackingContextKey{}, tracking{tracker: tracker, key: key})
+}
+
+// trackDestination returns the tracking of the delivery to the destination
+// with the given name, nested in the tracking carried by ctx, and a copy of
+// ctx carrying it, so the destinations of the destination are tracked under
+// it too.
+func trackDestination(ctx context.Context, name string) (context.Context, tracking) {
+	t, ok := ctx.Value(trackingContextKey{}).(tracking)
+	if !ok || t.tracker == nil || len(t.key) == 0 {
+		return ctx, tracking{}
+	}
+	t.key = t.key + "|" + name
+	return context.WithValue(ctx, trackingContextKey{}, t), t
+}
+
+func (t tracking) delivered() bool {
+	return t.tracker != nil && t.tracker.Delivered(t.key)
+}
+
+func (t tracking) markDelivered() {
+	if t.tracker != nil {
+		t.tracker.MarkDelivered(t.key)
+	}
+}
+
+// Config configures a named notifier. Only the settings of its type are
+// used.
+type Config struct {
+	Name           string         `yaml:"name"`
+	Type           string         `yaml:"type"`
+	Retry          RetryConfig    `yaml:"retry"`
+	CircuitBreaker BreakerConfig  `yaml:"circuit_breaker"`
+	Fallback       FallbackConfig `yaml:"fallback"`
+	// Optional notifiers don't make the service not ready when their
+	// destination is down, e.g. fallbacks.
+	Optional bool           `yaml:"optional"`
+	Gotify   GotifyConfig   `yaml:"gotify"`
+	NTFY     NTFYConfig     `yaml:"ntfy"`
+	Pushover PushoverConfig `yaml:"pushover"`
+	Telegram TelegramConfig `yaml:"telegram"`
+	Matrix   MatrixConfig   `yaml:"matrix"`
+	Discord  DiscordConfig  `yaml:"discord"`
+	Slack    SlackConfig    `yaml:"slack"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+}
+
+// New returns the notifier configured with config. Its fallbacks are set up
+// by NewRouting, as they refer to other notifiers.
+func New(config Config, template *alertmanager.Template) (Notifier, error) {
+	n, _, _, err := newNotifier(config, template)
+	return n, err
+}
+
+// newNotifier returns the notifier configured with config, its circuit
+// breaker, nil when it is disabled, and the prober of its destination. The
+// circuit breaker wraps the client, so each retry counts as a delivery and
+// retries stop once the circuit opens. The time of each request to the
+// destination and the result of each delivery, after retries, are reported
+// in the metrics. Each delivery and each of its attempts are traced.
+func newNotifier(config Config, template *alertmanager.Template) (Notifier, *Breaker, Prober, error) {
+	var n Notifier
+	var err error
+	switch config.Type {
 	case GotifyType:
-		return newGotifyClient()
+		n, err = newGotifyClient(config.Gotify, template)
 	case NTFYType:
-		return newNTFYClient()
+		n, err = newNTFYClient(config.NTFY, template)
+	case PushoverType:
+		n, err = newPushoverClient(config.Pushover, template)
+	case TelegramType:
+		n, err = newTelegramClient(config.Telegram, template)
+	case MatrixType:
+		n, err = newMatrixClient(config.Matrix, template)
+	case DiscordType:
+		n, err = newDiscordClient(config.Discord, template)
+	case SlackType:
+		n, err = newSlackClient(config.Slack, template)
+	case WebhookType:
+		n, err = newWebhookClient(config.Webhook, template)
 	default:
-		log.Fatalf("Wrong notifier type %s", notifierType)
-		return nil
+		err = fmt.Errorf("wrong notifier type %q", config.Type)
+	}
+
+	retryErr := config.Retry.validate()
+	breakerErr := config.CircuitBreaker.validate()
+	fallbackErr := config.Fallback.validate()
+	if err != nil || retryErr != nil || breakerErr != nil || fallbackErr != nil {
+		return nil, nil, nil, errors.Join(err, retryErr, breakerErr, fallbackErr)
+	}
+
+	prober, _ := n.(Prober)
+	n = newTracedNotifier("notifier attempt", config.Name, n)
+	n = newTimedNotifier(config.Name, n)
+	var breaker *Breaker
+	if config.CircuitBreaker.FailureThreshold > 0 {
+		breaker = NewBreaker(config.Name, n, config.CircuitBreaker)
+		n = breaker
+	}
+	if config.Retry.MaxAttempts > 1 {
+		n = NewRetry(config.Name, n, config.Retry)
+	}
+	n = newTracedNotifier("notifier", config.Name, n)
+	return newCountedNotifier(config.Name, n), breaker, prober, nil
+}
+
+// newHTTPClient returns the HTTP client of the notifiers, tracing the
+// requests to the destinations. Only the scheme and host of their URLs are
+// recorded in the spans, as some destinations take secrets in them.
+func newHTTPClient() http.Client {
+	return http.Client{Transport: tracing.Transport(redactURL)}
+}
+
+// get makes a GET request to url with the headers and returns an error when
+// the destination can't be reached or answers with an error. It is used to
+// probe the destinations.
+func get(ctx context.Context, httpClient *http.Client, timeout time.Duration, url string, header http.Header) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return NewErrNotAvailable(url, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newErrHTTPErrorFromResponse(resp, "", 0)
+	}
+	return nil
+}
+
+// truncate shortens value to at most maxLength characters.
+func truncate(value string, maxLength int) string {
+	runes := []rune(value)
+	if len(runes) <= maxLength {
+		return value
+	}
+	return string(runes[:maxLength-1]) + "…"
+}
+
+// Colors of the notifications of alerts, by status and severity.
+const (
+	colorResolved = 0x2EB67D
+	colorCritical = 0xE01E5A
+	colorWarning  = 0xECB22E
+	colorInfo     = 0x36C5F0
+)
+
+// alertColor returns the color of the notification of an alert: green when
+// resolved, and by severity otherwise, red for critical and unknown ones.
+func alertColor(data *alertmanager.Data) int {
+	if data.Status == "resolved" {
+		return colorResolved
+	}
+	switch data.Labels["severity"] {
+	case "warning":
+		return colorWarning
+	case "info", "none":
+		return colorInfo
+	default:
+		return colorCritical
+	}
+}
+
+// redactURL returns the scheme and host of url, leaving out the secrets of
+// the URLs that embed them, like webhook URLs.
+func redactURL(url string) string {
+	u, err := urlPkg.Parse(url)
+	if err != nil {
+		return "<redacted>"
+	}
+	return u.Scheme + "://" + u.Host + "/<redacted>"
+}
+
+// newErrRedactedNotAvailable returns the ErrNotAvailable of a failed request
+// to a URL with secrets, reported as redactedURL. The error is unwrapped from
+// the url.Error, as its message contains the URL.
+func newErrRedactedNotAvailable(redactedURL string, err error) error {
+	var urlErr *urlPkg.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return NewErrNotAvailable(redactedURL, err.Error())
+}
+
+// joinURL joins the path elements to the base URL and validates the result is
+// an absolute URL.
+func joinURL(base string, elements ...string) (string, error) {
+	joined, err := urlPkg.JoinPath(base, elements...)
+	if err != nil {
+		return "", err
+	}
+	url, err := urlPkg.ParseRequestURI(joined)
+	if err != nil {
+		return "", err
+	}
+	return url.String(), nil
+}
+
+// getTimeoutMillisEnvVariable returns the timeout set in the environment
+// variable name, 5000 when it is not set.
+func getTimeoutMillisEnvVariable(name string) (int, error) {
+	value := os.Getenv(name)
+	if len(value) != 0 {
+		timeout, err := strconv.Atoi(value)
+		if err != nil || timeout < 1 {
+			return 0, fmt.Errorf("invalid %s %q, must be a number greater than 0", name, value)
+		}
+		return timeout, nil
 	}
+	return 5000, nil
 }
@@ -2,11 +2,11 @@ package notifier
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	urlPkg "net/url"
 	"os"
 	"strconv"
 	"time"
@@ -23,59 +23,137 @@ const (
 	ntfyDefaultPriorityEnvVariable = "NTFY_DEFAULT_PRIORITY"
 )
 
+// NTFYConfig configures a ntfy notifier. Fields not set are taken from the
+// environment variables.
+type NTFYConfig struct {
+	URL             string `yaml:"url"`
+	Topic           string `yaml:"topic"`
+	User            string `yaml:"user"`
+	Password        string `yaml:"password"`
+	TimeoutMillis   int    `yaml:"timeout_millis"`
+	DefaultPriority int    `yaml:"default_priority"`
+}
+
+func (c *NTFYConfig) setDefaults() error {
+	errs := []error{}
+	if len(c.URL) == 0 {
+		c.URL = getNTFYURLEnvVariable()
+	}
+	if len(c.Topic) == 0 {
+		c.Topic = getNTFYTopicEnvVariable()
+	}
+	if len(c.User) == 0 {
+		c.User = getNTFYUserEnvVariable()
+	}
+	if len(c.Password) == 0 {
+		c.Password = getNTFYPasswordEnvVariable()
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getNTFYTimeoutMillisEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	if c.DefaultPriority == 0 {
+		defaultPriority, err := getNTFYDefaultPriorityEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.DefaultPriority = defaultPriority
+	}
+	return errors.Join(errs...)
+}
+
 type ntfyClient struct {
+	baseURL         string
 	url             string
 	user            string
 	password        string
 	defaultPriority int
+	template        *alertmanager.Template
+	timeout         time.Duration
 
 	httpClient http.Client
 }
 
-func newNTFYClient() *ntfyClient {
-	urlJoined, _ := urlPkg.JoinPath(getNTFYURLEnvVariable(), getNTFYTopicEnvVariable())
-	url, err := urlPkg.ParseRequestURI(urlJoined)
+// newNTFYClient returns a ntfy client configured with config. All the
+// problems found in the configuration are returned at once.
+func newNTFYClient(config NTFYConfig, template *alertmanager.Template) (*ntfyClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
 	if err != nil {
-		log.Fatalf("new ntfy client: %s", err)
+		errs = append(errs, err)
 	}
 
-	user := getNTFYUserEnvVariable()
-	password := getNTFYPasswordEnvVariable()
-	timeoutMillis := getNTFYTimeoutMillisEnvVariable()
-	defaultPriority := getNTFYDefaultPriorityEnvVariable()
-
-	httpClient := http.Client{
-		Timeout: time.Duration(timeoutMillis) * time.Millisecond,
+	url, err := joinURL(config.URL, config.Topic)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid ntfy url: %s", err))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid ntfy timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if config.DefaultPriority < 1 || config.DefaultPriority > 5 {
+		errs = append(errs, fmt.Errorf("invalid ntfy default priority %d, must be between 1 and 5 both included", config.DefaultPriority))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
 	}
 
-	return &ntfyClient{url.String(), user, password, defaultPriority, httpClient}
+	timeout := time.Duration(config.TimeoutMillis) * time.Millisecond
+
+	return &ntfyClient{config.URL, url, config.User, config.Password, config.DefaultPriority, template, timeout, newHTTPClient()}, nil
 }
 
-func (n *ntfyClient) Notify(alert alertmanager.Alert) error {
-	title, message, priority := alertmanager.ParseAlert(alert, n.defaultPriority)
+func (n *ntfyClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, priority, err := alertmanager.ParseAlert(data, n.template, n.defaultPriority)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
 
-	request, err := http.NewRequest(http.MethodPost, n.url, bytes.NewBufferString(message))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewBufferString(message))
 	if err != nil {
 		return fmt.Errorf("error creating request: %s", err)
 	}
 	request.Header.Set("Title", title)
 	request.Header.Set("Priority", strconv.Itoa(priority))
 	if n.user != "" {
-		encodedCredentials := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", n.user, n.password)))
-		request.Header.Set("Authorization", fmt.Sprintf("Basic %s", encodedCredentials))
+		request.Header.Set("Authorization", n.authorization())
 	}
 
 	resp, err := n.httpClient.Do(request)
 	if err != nil {
 		return NewErrNotAvailable(n.url, err.Error())
 	} else {
+		defer resp.Body.Close()
 		if resp.StatusCode >= http.StatusBadRequest {
-			return NewErrHTTPError(resp.StatusCode, http.StatusText(resp.StatusCode))
+			return newErrHTTPErrorFromResponse(resp, "", 0)
 		}
 	}
 	return nil
 }
 
+// Probe checks ntfy is healthy.
+func (n *ntfyClient) Probe(ctx context.Context) error {
+	healthURL, err := joinURL(n.baseURL, "v1", "health")
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if n.user != "" {
+		header.Set("Authorization", n.authorization())
+	}
+	return get(ctx, &n.httpClient, n.timeout, healthURL, header)
+}
+
+func (n *ntfyClient) authorization() string {
+	encodedCredentials := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", n.user, n.password)))
+	return fmt.Sprintf("Basic %s", encodedCredentials)
+}
+
 func getNTFYURLEnvVariable() string {
 	value := os.Getenv(ntfyURLEnvVariable)
 	if len(value) != 0 {
@@ -108,34 +186,26 @@ func getNTFYPasswordEnvVariable() string {
 	return ""
 }
 
-func getNTFYTimeoutMillisEnvVariable() int {
-	defaultTimeoutMillis := 5000
+func getNTFYTimeoutMillisEnvVariable() (int, error) {
 	value := os.Getenv(ntfyTimeoutMillisEnvVariable)
 	if len(value) != 0 {
 		timeout, err := strconv.Atoi(value)
 		if err != nil || timeout < 1 {
-			log.Printf("Invalid NTFY timeout. Defaults to: %d", defaultTimeoutMillis)
-			return defaultTimeoutMillis
+			return 0, fmt.Errorf("invalid %s %q, must be a number greater than 0", ntfyTimeoutMillisEnvVariable, value)
 		}
-		return timeout
+		return timeout, nil
 	}
-	return defaultTimeoutMillis
+	return 5000, nil
 }
 
-func getNTFYDefaultPriorityEnvVariable() int {
-	defaultPriority := 3
+func getNTFYDefaultPriorityEnvVariable() (int, error) {
 	value := os.Getenv(ntfyDefaultPriorityEnvVariable)
 	if len(value) != 0 {
-		userDefaultPriorityInt, err := strconv.Atoi(value)
-		if err != nil {
-			log.Printf("Invalid default priority value. Defaults to: %d", defaultPriority)
-			return defaultPriority
-		}
-		if userDefaultPriorityInt > 0 && userDefaultPriorityInt < 6 {
-			return userDefaultPriorityInt
-		} else {
-			log.Printf("Default priority should be between 1 and 5 both included")
+		defaultPriority, err := strconv.Atoi(value)
+		if err != nil || defaultPriority < 1 || defaultPriority > 5 {
+			return 0, fmt.Errorf("invalid %s %q, must be a number between 1 and 5 both included", ntfyDefaultPriorityEnvVariable, value)
 		}
+		return defaultPriority, nil
 	}
-	return defaultPriority
+	return 3, nil
 }
@@ -1,8 +1,16 @@
 package notifier
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
 )
 
 func Test_getNTFYTimeoutMillisEnvVariable(t *testing.T) {
@@ -10,36 +18,26 @@ func Test_getNTFYTimeoutMillisEnvVariable(t *testing.T) {
 
 	os.Setenv(ntfyTimeoutMillisEnvVariable, "10000")
 
-	actualTimeoutMillis := getNTFYTimeoutMillisEnvVariable()
+	actualTimeoutMillis, err := getNTFYTimeoutMillisEnvVariable()
 
-	if expectedTimeoutMillis != actualTimeoutMillis {
-		t.Errorf("Timeout was incorrect want: %+v, but got: %+v", expectedTimeoutMillis, actualTimeoutMillis)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
 	}
-	os.Unsetenv(ntfyTimeoutMillisEnvVariable)
-}
-
-func Test_getNTFYTimeoutMillisEnvVariable_negativeValue(t *testing.T) {
-	expectedTimeoutMillis := 5000
-
-	os.Setenv(ntfyTimeoutMillisEnvVariable, "-3000")
-
-	actualTimeoutMillis := getNTFYTimeoutMillisEnvVariable()
-
 	if expectedTimeoutMillis != actualTimeoutMillis {
 		t.Errorf("Timeout was incorrect want: %+v, but got: %+v", expectedTimeoutMillis, actualTimeoutMillis)
 	}
 	os.Unsetenv(ntfyTimeoutMillisEnvVariable)
 }
 
-func Test_getNTFYTimeoutMillisEnvVariable_badValue(t *testing.T) {
-	expectedTimeoutMillis := 5000
-
-	os.Setenv(ntfyTimeoutMillisEnvVariable, "bad")
+func Test_getNTFYTimeoutMillisEnvVariable_invalidValue(t *testing.T) {
+	for _, value := range []string{"-3000", "bad"} {
+		os.Setenv(ntfyTimeoutMillisEnvVariable, value)
 
-	actualTimeoutMillis := getNTFYTimeoutMillisEnvVariable()
+		_, err := getNTFYTimeoutMillisEnvVariable()
 
-	if expectedTimeoutMillis != actualTimeoutMillis {
-		t.Errorf("Timeout was incorrect want: %+v, but got: %+v", expectedTimeoutMillis, actualTimeoutMillis)
+		if err == nil {
+			t.Errorf("Expected an error for the invalid timeout %q", value)
+		}
 	}
 	os.Unsetenv(ntfyTimeoutMillisEnvVariable)
 }
@@ -47,8 +45,11 @@ func Test_getNTFYTimeoutMillisEnvVariable_badValue(t *testing.T) {
 func Test_getNTFYTimeoutMillisEnvVariable_noValue(t *testing.T) {
 	expectedTimeoutMillis := 5000
 
-	actualTimeoutMillis := getNTFYTimeoutMillisEnvVariable()
+	actualTimeoutMillis, err := getNTFYTimeoutMillisEnvVariable()
 
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
 	if expectedTimeoutMillis != actualTimeoutMillis {
 		t.Errorf("Timeout was incorrect want: %+v, but got: %+v", expectedTimeoutMillis, actualTimeoutMillis)
 	}
@@ -59,59 +60,106 @@ func Test_getNTFYDefaultPriorityEnvVariable(t *testing.T) {
 
 	os.Setenv(ntfyDefaultPriorityEnvVariable, "2")
 
-	actualDefaultPriority := getNTFYDefaultPriorityEnvVariable()
+	actualDefaultPriority, err := getNTFYDefaultPriorityEnvVariable()
 
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
 	if expectedDefaultPriority != actualDefaultPriority {
 		t.Errorf("Default priority was incorrect want: %+v, but got: %+v", expectedDefaultPriority, actualDefaultPriority)
 	}
 	os.Unsetenv(ntfyDefaultPriorityEnvVariable)
 }
 
-func Test_getNTFYDefaultPriorityEnvVariable_0(t *testing.T) {
-	expectedDefaultPriority := 3
-
-	os.Setenv(ntfyDefaultPriorityEnvVariable, "0")
+func Test_getNTFYDefaultPriorityEnvVariable_invalidValue(t *testing.T) {
+	for _, value := range []string{"0", "6", "bad"} {
+		os.Setenv(ntfyDefaultPriorityEnvVariable, value)
 
-	actualDefaultPriority := getNTFYDefaultPriorityEnvVariable()
+		_, err := getNTFYDefaultPriorityEnvVariable()
 
-	if expectedDefaultPriority != actualDefaultPriority {
-		t.Errorf("Default priority was incorrect want: %+v, but got: %+v", expectedDefaultPriority, actualDefaultPriority)
+		if err == nil {
+			t.Errorf("Expected an error for the invalid default priority %q", value)
+		}
 	}
 	os.Unsetenv(ntfyDefaultPriorityEnvVariable)
 }
 
-func Test_getNTFYDefaultPriorityEnvVariable_6(t *testing.T) {
+func Test_getNTFYDefaultPriorityEnvVariable_noValue(t *testing.T) {
 	expectedDefaultPriority := 3
 
-	os.Setenv(ntfyDefaultPriorityEnvVariable, "6")
-
-	actualDefaultPriority := getNTFYDefaultPriorityEnvVariable()
+	actualDefaultPriority, err := getNTFYDefaultPriorityEnvVariable()
 
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
 	if expectedDefaultPriority != actualDefaultPriority {
 		t.Errorf("Default priority was incorrect want: %+v, but got: %+v", expectedDefaultPriority, actualDefaultPriority)
 	}
-	os.Unsetenv(ntfyDefaultPriorityEnvVariable)
 }
 
-func Test_getNTFYDefaultPriorityEnvVariable_badValue(t *testing.T) {
-	expectedDefaultPriority := 3
+func Test_newNTFYClient_invalidEnvVariables(t *testing.T) {
+	os.Setenv(ntfyTimeoutMillisEnvVariable, "bad")
+	os.Setenv(ntfyDefaultPriorityEnvVariable, "6")
+	defer os.Unsetenv(ntfyTimeoutMillisEnvVariable)
+	defer os.Unsetenv(ntfyDefaultPriorityEnvVariable)
+
+	_, err := newNTFYClient(NTFYConfig{URL: "http://ntfy", Topic: "alerts"}, alertmanager.DefaultTemplate())
 
-	os.Setenv(ntfyDefaultPriorityEnvVariable, "bad")
+	if err == nil {
+		t.Fatalf("Expected an error for the invalid environment variables")
+	}
+	for _, want := range []string{ntfyTimeoutMillisEnvVariable, ntfyDefaultPriorityEnvVariable} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error should contain %q, got: %s", want, err)
+		}
+	}
+}
 
-	actualDefaultPriority := getNTFYDefaultPriorityEnvVariable()
+func Test_ntfyClientNotify_contextDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
 
-	if expectedDefaultPriority != actualDefaultPriority {
-		t.Errorf("Default priority was incorrect want: %+v, but got: %+v", expectedDefaultPriority, actualDefaultPriority)
+	client, err := newNTFYClient(NTFYConfig{URL: server.URL, TimeoutMillis: 5000}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = client.Notify(ctx, alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+
+	var errNotAvailable ErrNotAvailable
+	if !errors.As(err, &errNotAvailable) {
+		t.Errorf("Error was incorrect want: ErrNotAvailable, but got: %#v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify should return when the inbound deadline expires, but took: %s", elapsed)
 	}
-	os.Unsetenv(ntfyDefaultPriorityEnvVariable)
 }
 
-func Test_getNTFYDefaultPriorityEnvVariable_noValue(t *testing.T) {
-	expectedDefaultPriority := 3
+func Test_ntfyClientNotify_timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
 
-	actualDefaultPriority := getNTFYDefaultPriorityEnvVariable()
+	client, err := newNTFYClient(NTFYConfig{URL: server.URL, TimeoutMillis: 50}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
 
-	if expectedDefaultPriority != actualDefaultPriority {
-		t.Errorf("Default priority was incorrect want: %+v, but got: %+v", expectedDefaultPriority, actualDefaultPriority)
+	start := time.Now()
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+
+	var errNotAvailable ErrNotAvailable
+	if !errors.As(err, &errNotAvailable) {
+		t.Errorf("Error was incorrect want: ErrNotAvailable, but got: %#v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify should return when the notifier timeout expires, but took: %s", elapsed)
 	}
 }
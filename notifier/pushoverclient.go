@@ -0,0 +1,311 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	urlPkg "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const (
+	pushoverURLEnvVariable             = "PUSHOVER_URL"
+	pushoverTokenEnvVariable           = "PUSHOVER_TOKEN"
+	pushoverUserKeyEnvVariable         = "PUSHOVER_USER_KEY"
+	pushoverTimeoutMillisEnvVariable   = "PUSHOVER_TIMEOUT_MILLIS"
+	pushoverDefaultPriorityEnvVariable = "PUSHOVER_DEFAULT_PRIORITY"
+)
+
+const (
+	pushoverMinPriority       = -2
+	pushoverMaxPriority       = 2
+	pushoverEmergencyPriority = 2
+	pushoverMinRetrySeconds   = 30
+	pushoverMaxExpireSeconds  = 10800
+	pushoverMaxTitleLength    = 250
+	pushoverMaxMessageLength  = 1024
+	pushoverMaxURLLength      = 512
+	pushoverMaxURLTitleLength = 100
+)
+
+// PushoverConfig configures a pushover notifier. Fields not set are taken
+// from the environment variables.
+type PushoverConfig struct {
+	URL string `yaml:"url"`
+	// Token is the API token of the pushover application.
+	Token string `yaml:"token"`
+	// UserKey is the key of the user or group notified.
+	UserKey       string `yaml:"user_key"`
+	TimeoutMillis int    `yaml:"timeout_millis"`
+	// DefaultPriority is a pointer because 0 is a valid pushover priority.
+	DefaultPriority *int `yaml:"default_priority"`
+	// CriticalPriority is the priority of the alerts with the critical
+	// severity and no priority annotation.
+	CriticalPriority *int `yaml:"critical_priority"`
+	// RetrySeconds and ExpireSeconds are how often and for how long an
+	// emergency notification is repeated until it is acknowledged.
+	RetrySeconds  int `yaml:"retry_seconds"`
+	ExpireSeconds int `yaml:"expire_seconds"`
+	// URLTitle is the title of the link to the generator URL of the alert.
+	URLTitle string `yaml:"url_title"`
+	// HTML enables the HTML tags supported by pushover in the messages.
+	HTML bool `yaml:"html"`
+}
+
+func (c *PushoverConfig) setDefaults() error {
+	errs := []error{}
+	if len(c.URL) == 0 {
+		c.URL = getPushoverURLEnvVariable()
+	}
+	if len(c.Token) == 0 {
+		c.Token = os.Getenv(pushoverTokenEnvVariable)
+	}
+	if len(c.UserKey) == 0 {
+		c.UserKey = os.Getenv(pushoverUserKeyEnvVariable)
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getPushoverTimeoutMillisEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	if c.DefaultPriority == nil {
+		defaultPriority, err := getPushoverDefaultPriorityEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.DefaultPriority = &defaultPriority
+	}
+	if c.CriticalPriority == nil {
+		criticalPriority := pushoverEmergencyPriority
+		c.CriticalPriority = &criticalPriority
+	}
+	if c.RetrySeconds == 0 {
+		c.RetrySeconds = 60
+	}
+	if c.ExpireSeconds == 0 {
+		c.ExpireSeconds = 3600
+	}
+	if len(c.URLTitle) == 0 {
+		c.URLTitle = "Source"
+	}
+	return errors.Join(errs...)
+}
+
+type pushoverClient struct {
+	url              string
+	validateURL      string
+	token            string
+	userKey          string
+	defaultPriority  int
+	criticalPriority int
+	retry            int
+	expire           int
+	urlTitle         string
+	html             bool
+	template         *alertmanager.Template
+	timeout          time.Duration
+
+	httpClient http.Client
+}
+
+// pushoverResponse is the body of the pushover responses.
+type pushoverResponse struct {
+	Status int      `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+// newPushoverClient returns a pushover client configured with config. All
+// the problems found in the configuration are returned at once.
+func newPushoverClient(config PushoverConfig, template *alertmanager.Template) (*pushoverClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	url, err := joinURL(config.URL, "1", "messages.json")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid pushover url: %s", err))
+	}
+	validateURL, _ := joinURL(config.URL, "1", "users", "validate.json")
+	if len(config.Token) == 0 {
+		errs = append(errs, fmt.Errorf("pushover token is required"))
+	}
+	if len(config.UserKey) == 0 {
+		errs = append(errs, fmt.Errorf("pushover user key is required"))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid pushover timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if !validPushoverPriority(*config.DefaultPriority) {
+		errs = append(errs, fmt.Errorf("invalid pushover default priority %d, must be between %d and %d both included", *config.DefaultPriority, pushoverMinPriority, pushoverMaxPriority))
+	}
+	if !validPushoverPriority(*config.CriticalPriority) {
+		errs = append(errs, fmt.Errorf("invalid pushover critical priority %d, must be between %d and %d both included", *config.CriticalPriority, pushoverMinPriority, pushoverMaxPriority))
+	}
+	if config.RetrySeconds < pushoverMinRetrySeconds {
+		errs = append(errs, fmt.Errorf("invalid pushover retry %d, must be at least %d seconds", config.RetrySeconds, pushoverMinRetrySeconds))
+	}
+	if config.ExpireSeconds < 1 || config.ExpireSeconds > pushoverMaxExpireSeconds {
+		errs = append(errs, fmt.Errorf("invalid pushover expire %d, must be between 1 and %d seconds", config.ExpireSeconds, pushoverMaxExpireSeconds))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &pushoverClient{
+		url:              url,
+		validateURL:      validateURL,
+		token:            config.Token,
+		userKey:          config.UserKey,
+		defaultPriority:  *config.DefaultPriority,
+		criticalPriority: *config.CriticalPriority,
+		retry:            config.RetrySeconds,
+		expire:           config.ExpireSeconds,
+		urlTitle:         truncate(config.URLTitle, pushoverMaxURLTitleLength),
+		html:             config.HTML,
+		template:         template,
+		timeout:          time.Duration(config.TimeoutMillis) * time.Millisecond,
+		httpClient:       newHTTPClient(),
+	}, nil
+}
+
+func (p *pushoverClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	defaultPriority := p.defaultPriority
+	if data.Labels["severity"] == "critical" {
+		defaultPriority = p.criticalPriority
+	}
+	title, message, priority, err := alertmanager.ParseAlert(data, p.template, defaultPriority)
+	if err != nil {
+		return err
+	}
+	priority = p.priority(data, priority)
+
+	form := urlPkg.Values{}
+	form.Set("token", p.token)
+	form.Set("user", p.userKey)
+	form.Set("title", truncate(title, pushoverMaxTitleLength))
+	form.Set("message", truncate(message, pushoverMaxMessageLength))
+	form.Set("priority", strconv.Itoa(priority))
+	if priority == pushoverEmergencyPriority {
+		form.Set("retry", strconv.Itoa(p.retry))
+		form.Set("expire", strconv.Itoa(p.expire))
+	}
+	// Longer URLs are rejected by pushover and a truncated one is a broken
+	// link, so they are left out.
+	if length := len([]rune(data.GeneratorURL)); length != 0 && length <= pushoverMaxURLLength {
+		form.Set("url", data.GeneratorURL)
+		form.Set("url_title", p.urlTitle)
+	}
+	if p.html {
+		form.Set("html", "1")
+	}
+	timestamp := data.StartsAt
+	if data.Status == "resolved" {
+		timestamp = data.EndsAt
+	}
+	if !timestamp.IsZero() {
+		form.Set("timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	}
+
+	return p.post(ctx, p.url, form)
+}
+
+// priority returns the priority within the pushover scale. Resolved alerts
+// are never sent with emergency priority, as they need no acknowledgement.
+func (p *pushoverClient) priority(data *alertmanager.Data, priority int) int {
+	if !validPushoverPriority(priority) {
+		clamped := min(max(priority, pushoverMinPriority), pushoverMaxPriority)
+		slog.Warn("Pushover priority out of range, using the closest one", append(data.LogAttrs(), "priority", priority, "closest", clamped)...)
+		priority = clamped
+	}
+	if priority == pushoverEmergencyPriority && data.Status == "resolved" {
+		return pushoverEmergencyPriority - 1
+	}
+	return priority
+}
+
+// Probe checks pushover accepts the token and the user key.
+func (p *pushoverClient) Probe(ctx context.Context) error {
+	form := urlPkg.Values{}
+	form.Set("token", p.token)
+	form.Set("user", p.userKey)
+	return p.post(ctx, p.validateURL, form)
+}
+
+func (p *pushoverClient) post(ctx context.Context, url string, form urlPkg.Values) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(request)
+	if err != nil {
+		return NewErrNotAvailable(url, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newPushoverError(resp)
+	}
+	return nil
+}
+
+// newPushoverError returns the error for a failed response, with the errors
+// reported by pushover in its body as message, if any.
+func newPushoverError(resp *http.Response) error {
+	var body pushoverResponse
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(content, &body)
+	return newErrHTTPErrorFromResponse(resp, strings.Join(body.Errors, ", "), 0)
+}
+
+func validPushoverPriority(priority int) bool {
+	return priority >= pushoverMinPriority && priority <= pushoverMaxPriority
+}
+
+func getPushoverURLEnvVariable() string {
+	value := os.Getenv(pushoverURLEnvVariable)
+	if len(value) != 0 {
+		return value
+	}
+	return "https://api.pushover.net"
+}
+
+func getPushoverTimeoutMillisEnvVariable() (int, error) {
+	value := os.Getenv(pushoverTimeoutMillisEnvVariable)
+	if len(value) != 0 {
+		timeout, err := strconv.Atoi(value)
+		if err != nil || timeout < 1 {
+			return 0, fmt.Errorf("invalid %s %q, must be a number greater than 0", pushoverTimeoutMillisEnvVariable, value)
+		}
+		return timeout, nil
+	}
+	return 5000, nil
+}
+
+func getPushoverDefaultPriorityEnvVariable() (int, error) {
+	value := os.Getenv(pushoverDefaultPriorityEnvVariable)
+	if len(value) != 0 {
+		defaultPriority, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q, must be a number", pushoverDefaultPriorityEnvVariable, value)
+		}
+		return defaultPriority, nil
+	}
+	return 0, nil
+}
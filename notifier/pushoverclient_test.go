@@ -0,0 +1,191 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+// pushoverServer is a pushover stand-in recording the forms it receives and
+// answering with the given status code and body.
+func pushoverServer(t *testing.T, statusCode int, body string, forms chan<- url.Values) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("Unexpected error parsing the form: %s", err)
+		}
+		r.PostForm.Set("path", r.URL.Path)
+		forms <- r.PostForm
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_newPushoverClient_envDefaults(t *testing.T) {
+	os.Setenv(pushoverTokenEnvVariable, "env-token")
+	os.Setenv(pushoverUserKeyEnvVariable, "env-user")
+	defer os.Unsetenv(pushoverTokenEnvVariable)
+	defer os.Unsetenv(pushoverUserKeyEnvVariable)
+
+	client, err := newPushoverClient(PushoverConfig{UserKey: "user"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	if want := "https://api.pushover.net/1/messages.json"; client.url != want {
+		t.Errorf("URL was incorrect want: %+v, but got: %+v", want, client.url)
+	}
+	if client.token != "env-token" || client.userKey != "user" {
+		t.Errorf("Credentials were incorrect want: env-token and user, but got: %s and %s", client.token, client.userKey)
+	}
+	if client.defaultPriority != 0 || client.criticalPriority != pushoverEmergencyPriority {
+		t.Errorf("Priorities were incorrect want: 0 and %d, but got: %d and %d", pushoverEmergencyPriority, client.defaultPriority, client.criticalPriority)
+	}
+}
+
+func Test_newPushoverClient_invalidConfig(t *testing.T) {
+	defaultPriority := 3
+	_, err := newPushoverClient(PushoverConfig{DefaultPriority: &defaultPriority, RetrySeconds: 10, ExpireSeconds: 20000}, alertmanager.DefaultTemplate())
+
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid configuration")
+	}
+	for _, want := range []string{"token is required", "user key is required", "default priority 3", "retry 10", "expire 20000"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error should contain %q, got: %s", want, err)
+		}
+	}
+}
+
+func Test_pushoverClientNotify(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	server := pushoverServer(t, http.StatusOK, `{"status":1}`, forms)
+	client, err := newPushoverClient(PushoverConfig{URL: server.URL, Token: "token", UserKey: "user", HTML: true}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	startsAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	alert := alertmanager.Alert{
+		Status:       "firing",
+		Labels:       alertmanager.KV{"alertname": "HighLatency", "severity": "critical"},
+		StartsAt:     startsAt,
+		GeneratorURL: "http://prometheus/graph",
+	}
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	form := <-forms
+	want := map[string]string{
+		"path":      "/1/messages.json",
+		"token":     "token",
+		"user":      "user",
+		"priority":  "2",
+		"retry":     "60",
+		"expire":    "3600",
+		"url":       "http://prometheus/graph",
+		"url_title": "Source",
+		"html":      "1",
+		"timestamp": "1714557600",
+	}
+	for key, value := range want {
+		if form.Get(key) != value {
+			t.Errorf("Field %s was incorrect want: %+v, but got: %+v", key, value, form.Get(key))
+		}
+	}
+
+	alert.Status = "resolved"
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	form = <-forms
+	if form.Get("priority") != "1" || form.Has("retry") {
+		t.Errorf("Resolved alerts should not be sent with emergency priority, got priority %s and retry %s", form.Get("priority"), form.Get("retry"))
+	}
+
+	alert.GeneratorURL = "http://prometheus/graph?g0.expr=" + strings.Repeat("a", pushoverMaxURLLength)
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	form = <-forms
+	if form.Has("url") || form.Has("url_title") {
+		t.Errorf("URLs longer than %d characters should be left out, got url %s and url_title %s", pushoverMaxURLLength, form.Get("url"), form.Get("url_title"))
+	}
+}
+
+func Test_pushoverClient_priority(t *testing.T) {
+	client := &pushoverClient{}
+	tests := []struct {
+		status   string
+		priority int
+		want     int
+	}{
+		{"firing", -5, -2},
+		{"firing", 1, 1},
+		{"firing", 7, 2},
+		{"resolved", 2, 1},
+	}
+	for _, test := range tests {
+		data := alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: test.status})
+		if got := client.priority(data, test.priority); got != test.want {
+			t.Errorf("Priority of %s alert with priority %d was incorrect want: %+v, but got: %+v", test.status, test.priority, test.want, got)
+		}
+	}
+}
+
+func Test_pushoverClientNotify_errors(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	server := pushoverServer(t, http.StatusBadRequest, `{"user":"invalid","errors":["user identifier is invalid"],"status":0}`, forms)
+	client, err := newPushoverClient(PushoverConfig{URL: server.URL, Token: "token", UserKey: "user"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	var errHTTPError ErrHTTPError
+	if !errors.As(err, &errHTTPError) || errHTTPError.Code() != http.StatusBadRequest {
+		t.Fatalf("Error was incorrect want: ErrHTTPError with code 400, but got: %#v", err)
+	}
+	if !strings.Contains(err.Error(), "user identifier is invalid") {
+		t.Errorf("Error should contain the errors reported by pushover, got: %s", err)
+	}
+
+	server.Close()
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	var errNotAvailable ErrNotAvailable
+	if !errors.As(err, &errNotAvailable) {
+		t.Errorf("Error was incorrect want: ErrNotAvailable, but got: %#v", err)
+	}
+}
+
+func Test_pushoverClientProbe(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	server := pushoverServer(t, http.StatusOK, `{"status":1}`, forms)
+	client, err := newPushoverClient(PushoverConfig{URL: server.URL, Token: "token", UserKey: "user"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Probe(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error probing pushover: %s", err)
+	}
+	form := <-forms
+	if form.Get("path") != "/1/users/validate.json" || form.Get("token") != "token" || form.Get("user") != "user" {
+		t.Errorf("Probe should validate the token and user key, got: %+v", form)
+	}
+}
@@ -0,0 +1,113 @@
+package notifier
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+const (
+	BackendUp   string = "up"
+	BackendDown string = "down"
+)
+
+// Prober checks whether the destination of a notifier is reachable and
+// accepts its credentials, without delivering any notification.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Probe is the readiness check of a notifier.
+type Probe struct {
+	Type string
+	// Optional probes don't make the service not ready when they fail.
+	Optional bool
+	Prober   Prober
+}
+
+// BackendStatus is the result of the readiness check of a notifier.
+type BackendStatus struct {
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Optional  bool      `json:"optional"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Readiness checks the destinations of the notifiers, caching the results
+// for cacheTime so frequent checks don't flood them.
+type Readiness struct {
+	probes    map[string]Probe
+	cacheTime time.Duration
+	now       func() time.Time
+
+	mutex   sync.Mutex
+	results map[string]BackendStatus
+}
+
+// NewReadiness returns the readiness check of the probes, by notifier name.
+func NewReadiness(probes map[string]Probe, cacheTime time.Duration) *Readiness {
+	return &Readiness{probes: probes, cacheTime: cacheTime, now: time.Now, results: map[string]BackendStatus{}}
+}
+
+// Check returns the status of every notifier and whether all the required
+// ones are up. Only the notifiers whose cached result expired are probed,
+// concurrently. Probes are not cancelled with ctx, so their results can be
+// cached even when the caller goes away.
+func (r *Readiness) Check(ctx context.Context) (map[string]BackendStatus, bool) {
+	ctx = context.WithoutCancel(ctx)
+
+	// The mutex is held while probing, so concurrent checks wait for the
+	// results instead of probing again.
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// The probes to run are chosen before starting any of them, and their
+	// results are merged once they all finish, so the cached results are
+	// not read while being written.
+	stale := map[string]Probe{}
+	for name, probe := range r.probes {
+		if result, ok := r.results[name]; ok && r.now().Sub(result.CheckedAt) < r.cacheTime {
+			continue
+		}
+		stale[name] = probe
+	}
+
+	var probedMutex sync.Mutex
+	probed := make(map[string]BackendStatus, len(stale))
+	var wg sync.WaitGroup
+	for name, probe := range stale {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := BackendStatus{Type: probe.Type, Status: BackendUp, Optional: probe.Optional}
+			err := probe.Prober.Probe(ctx)
+			if err != nil {
+				slog.Warn("Notifier destination not ready", logging.NotifierKey, name, logging.Error(err))
+				result.Status = BackendDown
+				result.Error = err.Error()
+			}
+			result.CheckedAt = r.now()
+
+			probedMutex.Lock()
+			probed[name] = result
+			probedMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	maps.Copy(r.results, probed)
+
+	ready := true
+	results := make(map[string]BackendStatus, len(r.results))
+	for name, result := range r.results {
+		results[name] = result
+		if result.Status != BackendUp && !result.Optional {
+			ready = false
+		}
+	}
+	return results, ready
+}
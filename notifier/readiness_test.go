@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+type fakeProber struct {
+	err   error
+	calls atomic.Int32
+}
+
+func (p *fakeProber) Probe(ctx context.Context) error {
+	p.calls.Add(1)
+	return p.err
+}
+
+func Test_readiness(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	gotify := &fakeProber{}
+	ntfy := &fakeProber{err: NewErrNotAvailable("http://ntfy", "connection refused")}
+	readiness := NewReadiness(map[string]Probe{
+		"gotify": {Type: GotifyType, Prober: gotify},
+		"ntfy":   {Type: NTFYType, Optional: true, Prober: ntfy},
+	}, time.Second)
+	readiness.now = func() time.Time { return now }
+
+	results, ready := readiness.Check(context.Background())
+	if !ready {
+		t.Errorf("Should be ready when only optional notifiers are down, got: %+v", results)
+	}
+	want := BackendStatus{Type: NTFYType, Status: BackendDown, Optional: true, Error: ntfy.err.Error(), CheckedAt: now}
+	if results["ntfy"] != want {
+		t.Errorf("Status was incorrect want: %+v, but got: %+v", want, results["ntfy"])
+	}
+
+	gotify.err = NewErrHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	_, ready = readiness.Check(context.Background())
+	if !ready || gotify.calls.Load() != 1 {
+		t.Errorf("Cached results should be used, got ready %t and %d probes", ready, gotify.calls.Load())
+	}
+
+	now = now.Add(time.Second)
+	results, ready = readiness.Check(context.Background())
+	if ready || results["gotify"].Status != BackendDown || gotify.calls.Load() != 2 {
+		t.Errorf("Expired results should be probed again, got ready %t, status %+v and %d probes", ready, results["gotify"], gotify.calls.Load())
+	}
+}
+
+func Test_readiness_concurrentChecks(t *testing.T) {
+	probes := map[string]Probe{}
+	for _, name := range []string{"gotify", "ntfy", "pushover", "telegram"} {
+		probes[name] = Probe{Type: name, Prober: &fakeProber{}}
+	}
+	readiness := NewReadiness(probes, 0)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, ready := readiness.Check(context.Background())
+			if !ready || len(results) != len(probes) {
+				t.Errorf("Concurrent checks should report every notifier up, got ready %t and %+v", ready, results)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_gotifyClientProbe(t *testing.T) {
+	tests := []struct {
+		name            string
+		healthCode      int
+		applicationCode int
+		wantErr         bool
+	}{
+		{"healthy", http.StatusOK, http.StatusOK, false},
+		{"unhealthy", http.StatusInternalServerError, http.StatusOK, true},
+		{"token rejected", http.StatusOK, http.StatusUnauthorized, true},
+		{"token check not supported", http.StatusOK, http.StatusNotFound, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/health":
+					w.WriteHeader(test.healthCode)
+				case "/current/application":
+					if r.Header.Get("X-Gotify-Key") != "token" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					w.WriteHeader(test.applicationCode)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			client, err := newGotifyClient(GotifyConfig{URL: server.URL, Token: "token", TimeoutMillis: 1000}, alertmanager.DefaultTemplate())
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %s", err)
+			}
+
+			err = client.Probe(context.Background())
+			if (err != nil) != test.wantErr {
+				t.Errorf("Error was incorrect want error: %t, but got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_ntfyClientProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"healthy":true}`))
+	}))
+
+	client, err := newNTFYClient(NTFYConfig{URL: server.URL, TimeoutMillis: 1000}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Probe(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error probing a healthy ntfy: %s", err)
+	}
+
+	server.Close()
+	err = client.Probe(context.Background())
+	var errNotAvailable ErrNotAvailable
+	if !errors.As(err, &errNotAvailable) {
+		t.Errorf("Error was incorrect want: ErrNotAvailable, but got: %#v", err)
+	}
+}
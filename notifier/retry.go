@@ -0,0 +1,196 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+	"github.com/dcasado/alertmanager-notifier/metrics"
+)
+
+const (
+	defaultBaseBackoffMillis = 500
+	defaultMaxBackoffMillis  = 30000
+	defaultJitter            = 0.2
+)
+
+var defaultRetryableStatusCodes = []int{429, 500, 502, 503, 504}
+
+// RetryConfig configures the retries of a notifier. Deliveries are not
+// retried unless MaxAttempts is greater than 1.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of delivery attempts, including the
+	// first one.
+	MaxAttempts int `yaml:"max_attempts"`
+	// BaseBackoffMillis is the delay before the first retry. It doubles on
+	// each retry up to MaxBackoffMillis.
+	BaseBackoffMillis int `yaml:"base_backoff_millis"`
+	MaxBackoffMillis  int `yaml:"max_backoff_millis"`
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomly subtracted from it.
+	Jitter *float64 `yaml:"jitter"`
+	// RetryableStatusCodes are the status codes returned by the destination
+	// that are retried. Connection errors and timeouts are always retried.
+	RetryableStatusCodes []int `yaml:"retryable_status_codes"`
+}
+
+func (c RetryConfig) validate() error {
+	errs := []error{}
+	if c.MaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("invalid retry max attempts %d, must be a positive number", c.MaxAttempts))
+	}
+	if c.BaseBackoffMillis < 0 || c.MaxBackoffMillis < 0 {
+		errs = append(errs, fmt.Errorf("invalid retry backoff, must be a positive number"))
+	}
+	if c.BaseBackoffMillis > 0 && c.MaxBackoffMillis > 0 && c.BaseBackoffMillis > c.MaxBackoffMillis {
+		errs = append(errs, fmt.Errorf("invalid retry backoff, base backoff %d is greater than max backoff %d", c.BaseBackoffMillis, c.MaxBackoffMillis))
+	}
+	if c.Jitter != nil && (*c.Jitter < 0 || *c.Jitter > 1) {
+		errs = append(errs, fmt.Errorf("invalid retry jitter %v, must be between 0 and 1", *c.Jitter))
+	}
+	return errors.Join(errs...)
+}
+
+// ErrRetriesExhausted is returned by a retry notifier when every attempt of
+// a delivery failed. It wraps the error of the last attempt.
+type ErrRetriesExhausted struct {
+	attempts int
+	err      error
+}
+
+func NewErrRetriesExhausted(attempts int, err error) error {
+	return ErrRetriesExhausted{attempts: attempts, err: err}
+}
+
+func (e ErrRetriesExhausted) Error() string {
+	return fmt.Sprintf("%s, giving up after %d attempts", e.err, e.attempts)
+}
+
+func (e ErrRetriesExhausted) Unwrap() error {
+	return e.err
+}
+
+type retryNotifier struct {
+	name                 string
+	notifier             Notifier
+	maxAttempts          int
+	baseBackoff          time.Duration
+	maxBackoff           time.Duration
+	jitter               float64
+	retryableStatusCodes []int
+}
+
+// NewRetry returns a notifier retrying the failed deliveries of n with an
+// exponential backoff, returning an ErrRetriesExhausted once the attempts
+// are exhausted. The delay requested by the destination with the
+// Retry-After header is honored, and the error is returned without retrying
+// when the delay exceeds the max backoff or the deadline of the context.
+func NewRetry(name string, n Notifier, config RetryConfig) Notifier {
+	r := &retryNotifier{
+		name:                 name,
+		notifier:             n,
+		maxAttempts:          config.MaxAttempts,
+		baseBackoff:          defaultBaseBackoffMillis * time.Millisecond,
+		maxBackoff:           defaultMaxBackoffMillis * time.Millisecond,
+		jitter:               defaultJitter,
+		retryableStatusCodes: defaultRetryableStatusCodes,
+	}
+	if config.BaseBackoffMillis > 0 {
+		r.baseBackoff = time.Duration(config.BaseBackoffMillis) * time.Millisecond
+	}
+	if config.MaxBackoffMillis > 0 {
+		r.maxBackoff = time.Duration(config.MaxBackoffMillis) * time.Millisecond
+	}
+	if config.Jitter != nil {
+		r.jitter = *config.Jitter
+	}
+	if len(config.RetryableStatusCodes) != 0 {
+		r.retryableStatusCodes = config.RetryableStatusCodes
+	}
+	return r
+}
+
+func (r *retryNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	logger := logging.FromContext(ctx).With(logging.NotifierKey, r.name, "max_attempts", r.maxAttempts)
+	for attempt := 1; ; attempt++ {
+		err := r.notifier.Notify(ctx, data)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("Delivery attempt succeeded", logging.AttemptKey, attempt)
+			}
+			return nil
+		}
+
+		if !r.retryable(err) {
+			logger.Warn("Delivery attempt failed, giving up", logging.AttemptKey, attempt, logging.Error(err))
+			return err
+		}
+		if attempt == r.maxAttempts {
+			logger.Warn("Delivery attempt failed, giving up", logging.AttemptKey, attempt, logging.Error(err))
+			return NewErrRetriesExhausted(attempt, err)
+		}
+
+		delay, ok := r.delay(ctx, attempt, err)
+		if !ok {
+			logger.Warn("Delivery attempt failed, not enough time left to retry", logging.AttemptKey, attempt, logging.Error(err))
+			return err
+		}
+		logger.Warn("Delivery attempt failed, retrying", logging.AttemptKey, attempt, "delay", delay, logging.Error(err))
+		metrics.Retries.WithLabelValues(r.name).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *retryNotifier) retryable(err error) bool {
+	var errNotAvailable ErrNotAvailable
+	if errors.As(err, &errNotAvailable) {
+		return true
+	}
+	var errHTTPError ErrHTTPError
+	if errors.As(err, &errHTTPError) {
+		return slices.Contains(r.retryableStatusCodes, errHTTPError.Code())
+	}
+	return false
+}
+
+// delay returns the time to wait before the next attempt, and whether there
+// is enough time to make it.
+func (r *retryNotifier) delay(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	delay := r.backoff(attempt)
+
+	var errHTTPError ErrHTTPError
+	if errors.As(err, &errHTTPError) && errHTTPError.RetryAfter() > 0 {
+		delay = errHTTPError.RetryAfter()
+		if delay > r.maxBackoff {
+			return 0, false
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// backoff returns the exponential backoff delay before the retry following
+// the given attempt, with jitter applied.
+func (r *retryNotifier) backoff(attempt int) time.Duration {
+	delay := r.baseBackoff
+	for i := 1; i < attempt && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.maxBackoff)
+	return delay - time.Duration(r.jitter*rand.Float64()*float64(delay))
+}
@@ -0,0 +1,162 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+// sequenceNotifier returns the errors in order, one per call, and nil once
+// they are exhausted.
+type sequenceNotifier struct {
+	errs  []error
+	calls int
+}
+
+func (s *sequenceNotifier) Notify(ctx context.Context, data *alertmanager.Data) error {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return s.errs[s.calls-1]
+	}
+	return nil
+}
+
+func testRetryConfig(maxAttempts int) RetryConfig {
+	jitter := 0.0
+	return RetryConfig{MaxAttempts: maxAttempts, BaseBackoffMillis: 1, MaxBackoffMillis: 10, Jitter: &jitter}
+}
+
+func Test_retryNotifier(t *testing.T) {
+	expectedCalls := 3
+
+	n := &sequenceNotifier{errs: []error{NewErrNotAvailable("http://ntfy", "timeout"), NewErrHTTPError(503, "Service Unavailable")}}
+	r := NewRetry("ntfy", n, testRetryConfig(5))
+
+	err := r.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if expectedCalls != n.calls {
+		t.Errorf("Calls were incorrect want: %+v, but got: %+v", expectedCalls, n.calls)
+	}
+}
+
+func Test_retryNotifier_maxAttempts(t *testing.T) {
+	expectedCalls := 2
+
+	n := &sequenceNotifier{errs: []error{NewErrHTTPError(500, "Internal Server Error"), NewErrHTTPError(502, "Bad Gateway"), nil}}
+	r := NewRetry("ntfy", n, testRetryConfig(2))
+
+	err := r.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	var errHTTPError ErrHTTPError
+	if !errors.As(err, &errHTTPError) || errHTTPError.Code() != 502 {
+		t.Errorf("Error was incorrect want: the last attempt error, but got: %#v", err)
+	}
+	var errRetriesExhausted ErrRetriesExhausted
+	if !errors.As(err, &errRetriesExhausted) || err.Error() != "destination returned and error. Code: 502 Reason: Bad Gateway, giving up after 2 attempts" {
+		t.Errorf("Error was incorrect want: ErrRetriesExhausted, but got: %#v", err)
+	}
+	if expectedCalls != n.calls {
+		t.Errorf("Calls were incorrect want: %+v, but got: %+v", expectedCalls, n.calls)
+	}
+}
+
+func Test_retryNotifier_notRetryable(t *testing.T) {
+	expectedCalls := 1
+
+	n := &sequenceNotifier{errs: []error{NewErrHTTPError(401, "Unauthorized")}}
+	r := NewRetry("gotify", n, testRetryConfig(5))
+
+	err := r.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	if err == nil {
+		t.Errorf("Expected an error for a status code that is not retryable")
+	}
+	var errRetriesExhausted ErrRetriesExhausted
+	if errors.As(err, &errRetriesExhausted) {
+		t.Errorf("Errors that are not retried should not exhaust the retries, got: %#v", err)
+	}
+	if expectedCalls != n.calls {
+		t.Errorf("Calls were incorrect want: %+v, but got: %+v", expectedCalls, n.calls)
+	}
+}
+
+func Test_retryNotifier_notRetryableOnLastAttempt(t *testing.T) {
+	expectedCalls := 2
+
+	n := &sequenceNotifier{errs: []error{NewErrHTTPError(503, "Service Unavailable"), NewErrHTTPError(401, "Unauthorized")}}
+	r := NewRetry("gotify", n, testRetryConfig(2))
+
+	err := r.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	var errRetriesExhausted ErrRetriesExhausted
+	if err == nil || errors.As(err, &errRetriesExhausted) {
+		t.Errorf("Errors that are not retried should not exhaust the retries on the last attempt either, got: %#v", err)
+	}
+	if expectedCalls != n.calls {
+		t.Errorf("Calls were incorrect want: %+v, but got: %+v", expectedCalls, n.calls)
+	}
+}
+
+func Test_retryNotifier_retryAfterExceedsMaxBackoff(t *testing.T) {
+	expectedCalls := 1
+
+	n := &sequenceNotifier{errs: []error{ErrHTTPError{code: 429, msg: "Too Many Requests", retryAfter: time.Minute}}}
+	r := NewRetry("gotify", n, testRetryConfig(5))
+
+	err := r.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	if err == nil {
+		t.Errorf("Expected an error when the destination asks to retry after the max backoff")
+	}
+	if expectedCalls != n.calls {
+		t.Errorf("Calls were incorrect want: %+v, but got: %+v", expectedCalls, n.calls)
+	}
+}
+
+func Test_retryNotifier_contextDeadline(t *testing.T) {
+	expectedCalls := 1
+
+	jitter := 0.0
+	n := &sequenceNotifier{errs: []error{NewErrNotAvailable("http://ntfy", "timeout")}}
+	r := NewRetry("ntfy", n, RetryConfig{MaxAttempts: 5, BaseBackoffMillis: 1000, Jitter: &jitter})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := r.Notify(ctx, alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	if err == nil {
+		t.Errorf("Expected an error when there is no time left to retry")
+	}
+	if expectedCalls != n.calls {
+		t.Errorf("Calls were incorrect want: %+v, but got: %+v", expectedCalls, n.calls)
+	}
+}
+
+func Test_retryNotifier_backoff(t *testing.T) {
+	jitter := 0.0
+	r := NewRetry("ntfy", nil, RetryConfig{MaxAttempts: 10, BaseBackoffMillis: 100, MaxBackoffMillis: 1000, Jitter: &jitter}).(*retryNotifier)
+
+	expectedDelays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, expected := range expectedDelays {
+		if actual := r.backoff(i + 1); expected != actual {
+			t.Errorf("Backoff of attempt %d was incorrect want: %s, but got: %s", i+1, expected, actual)
+		}
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	if actual := parseRetryAfter("120"); actual != 2*time.Minute {
+		t.Errorf("Retry-After was incorrect want: 2m0s, but got: %s", actual)
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if actual := parseRetryAfter(date); actual < 59*time.Minute || actual > time.Hour {
+		t.Errorf("Retry-After was incorrect want: about 1h, but got: %s", actual)
+	}
+
+	if actual := parseRetryAfter("bad"); actual != 0 {
+		t.Errorf("Retry-After was incorrect want: 0s, but got: %s", actual)
+	}
+}
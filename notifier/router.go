@@ -0,0 +1,117 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+// Route is a node of the routing tree. An alert matching the route is sent to
+// the notifiers of its matching child routes or, if none of them matches, to
+// the notifier of the route itself. Child routes are evaluated in order
+// and the evaluation stops at the first matching one unless it has Continue
+// set.
+type Route struct {
+	Matchers []*Matcher
+	Notifier string
+	Continue bool
+	Routes   []*Route
+}
+
+// Matches returns the names of the notifiers the labels are routed to by the
+// route, in evaluation order and without duplicates.
+func (r *Route) Matches(labels alertmanager.KV) []string {
+	names := r.match(labels)
+
+	unique := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+func (r *Route) match(labels alertmanager.KV) []string {
+	for _, matcher := range r.Matchers {
+		if !matcher.Matches(labels) {
+			return nil
+		}
+	}
+
+	names := []string{}
+	for _, child := range r.Routes {
+		childNames := child.match(labels)
+		if len(childNames) == 0 {
+			continue
+		}
+		names = append(names, childNames...)
+		if !child.Continue {
+			break
+		}
+	}
+
+	if len(names) == 0 {
+		names = append(names, r.Notifier)
+	}
+	return names
+}
+
+type router struct {
+	route     *Route
+	notifiers map[string]Notifier
+}
+
+// NewRouter returns a notifier delivering each alert to the notifiers it is
+// routed to by the route. The root route is the default route: it matches
+// every alert and must have a notifier. Child routes without notifier inherit
+// the notifier of their parent.
+func NewRouter(route *Route, notifiers map[string]Notifier) (Notifier, error) {
+	if len(route.Matchers) != 0 {
+		return nil, fmt.Errorf("the default route cannot have matchers")
+	}
+	if len(route.Notifier) == 0 {
+		return nil, fmt.Errorf("the default route must have a notifier")
+	}
+
+	err := inheritNotifiers(route, notifiers)
+	if err != nil {
+		return nil, err
+	}
+	return &router{route: route, notifiers: notifiers}, nil
+}
+
+func inheritNotifiers(route *Route, notifiers map[string]Notifier) error {
+	if _, ok := notifiers[route.Notifier]; !ok {
+		return fmt.Errorf("unknown notifier %s", route.Notifier)
+	}
+	for _, child := range route.Routes {
+		if len(child.Notifier) == 0 {
+			child.Notifier = route.Notifier
+		}
+		err := inheritNotifiers(child, notifiers)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *router) Notify(ctx context.Context, data *alertmanager.Data) error {
+	names := r.route.Matches(data.Labels)
+	logging.FromContext(ctx).Debug("Alert routed", "notifiers", names)
+
+	if len(names) == 1 {
+		return r.notifiers[names[0]].Notify(ctx, data)
+	}
+
+	destinations := make([]Destination, 0, len(names))
+	for _, name := range names {
+		destinations = append(destinations, Destination{Name: name, Notifier: r.notifiers[name]})
+	}
+	return NewMulti(destinations...).Notify(ctx, data)
+}
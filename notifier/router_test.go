@@ -0,0 +1,214 @@
+package notifier
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func mustParseMatchers(t *testing.T, texts ...string) []*Matcher {
+	matchers := []*Matcher{}
+	for _, text := range texts {
+		matcher, err := ParseMatcher(text)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing matcher %s: %s", text, err)
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers
+}
+
+func testRoute(t *testing.T) *Route {
+	return &Route{
+		Notifier: "default",
+		Routes: []*Route{
+			{Matchers: mustParseMatchers(t, "team=db"), Notifier: "db", Continue: true},
+			{Matchers: mustParseMatchers(t, "severity=~critical|page"), Notifier: "oncall"},
+			{Matchers: mustParseMatchers(t, "team=web"), Routes: []*Route{
+				{Matchers: mustParseMatchers(t, "severity=warning"), Notifier: "web-low"},
+			}},
+		},
+	}
+}
+
+func Test_routeMatches(t *testing.T) {
+	tests := []struct {
+		labels   alertmanager.KV
+		expected []string
+	}{
+		{alertmanager.KV{"team": "db", "severity": "warning"}, []string{"db"}},
+		{alertmanager.KV{"team": "db", "severity": "critical"}, []string{"db", "oncall"}},
+		{alertmanager.KV{"team": "web", "severity": "page"}, []string{"oncall"}},
+		{alertmanager.KV{"team": "web", "severity": "warning"}, []string{"web-low"}},
+		{alertmanager.KV{"team": "web", "severity": "info"}, []string{"default"}},
+		{alertmanager.KV{}, []string{"default"}},
+	}
+
+	notifiers := map[string]Notifier{"default": nil, "db": nil, "oncall": nil, "web-low": nil}
+	route := testRoute(t)
+	_, err := NewRouter(route, notifiers)
+	if err != nil {
+		t.Fatalf("Unexpected error creating router: %s", err)
+	}
+
+	for _, test := range tests {
+		actual := route.Matches(test.labels)
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("Notifiers for %v were incorrect want: %+v, but got: %+v", test.labels, test.expected, actual)
+		}
+	}
+}
+
+func Test_newRouter_unknownNotifier(t *testing.T) {
+	_, err := NewRouter(testRoute(t), map[string]Notifier{"default": nil, "db": nil})
+	if err == nil {
+		t.Errorf("Expected an error when a route uses an unknown notifier")
+	}
+}
+
+func Test_routerNotify(t *testing.T) {
+	defaultNotifier := &fakeNotifier{}
+	db := &fakeNotifier{}
+	oncall := &fakeNotifier{}
+	notifiers := map[string]Notifier{"default": defaultNotifier, "db": db, "oncall": oncall, "web-low": &fakeNotifier{}}
+
+	r, err := NewRouter(testRoute(t), notifiers)
+	if err != nil {
+		t.Fatalf("Unexpected error creating router: %s", err)
+	}
+
+	alert := alertmanager.Alert{Labels: alertmanager.KV{"team": "db", "severity": "page"}}
+	err = r.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if defaultNotifier.calls != 0 || db.calls != 1 || oncall.calls != 1 {
+		t.Errorf("Notifier calls were incorrect, got default: %d, db: %d, oncall: %d", defaultNotifier.calls, db.calls, oncall.calls)
+	}
+}
+
+// client returns the client of a notifier created by newNotifier, without
+// the notifiers instrumenting it.
+func client(n Notifier) Notifier {
+	for {
+		switch wrapper := n.(type) {
+		case *countedNotifier:
+			n = wrapper.notifier
+		case *timedNotifier:
+			n = wrapper.notifier
+		case *tracedNotifier:
+			n = wrapper.notifier
+		default:
+			return n
+		}
+	}
+}
+
+func Test_newRouting(t *testing.T) {
+	configs := []Config{
+		{Name: "ops", Type: GotifyType, Gotify: GotifyConfig{Token: "token"}},
+		{Name: "db", Type: NTFYType, NTFY: NTFYConfig{Topic: "db"}},
+	}
+	route := &RouteConfig{Notifier: "ops", Routes: []RouteConfig{{Matchers: []string{"team=db"}, Notifier: "db"}}}
+	receiverConfigs := []ReceiverConfig{{Name: "ops", Notifiers: []string{"ops"}}, {Name: "all", Notifiers: []string{"ops", "db"}}}
+
+	routing, err := NewRouting(configs, route, receiverConfigs, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing: %s", err)
+	}
+
+	r := routing.Router.(*router)
+	if token := client(r.notifiers["ops"]).(*gotifyClient).token; token != "token" {
+		t.Errorf("Gotify token was incorrect want: token, but got: %+v", token)
+	}
+	if url := client(r.notifiers["db"]).(*ntfyClient).url; url != "http://localhost:8080/db" {
+		t.Errorf("NTFY url was incorrect want: http://localhost:8080/db, but got: %+v", url)
+	}
+	if _, ok := client(routing.Receivers["ops"]).(*gotifyClient); !ok || routing.Receivers["ops"] != r.notifiers["ops"] {
+		t.Errorf("Receiver ops should deliver to the ops notifier, but got: %#v", routing.Receivers["ops"])
+	}
+	if all, ok := routing.Receivers["all"].(*multiNotifier); !ok || len(all.destinations) != 2 {
+		t.Errorf("Receiver all should deliver to two notifiers, but got: %#v", routing.Receivers["all"])
+	}
+}
+
+func Test_newRouting_noRoute(t *testing.T) {
+	configs := []Config{
+		{Name: "ops", Type: GotifyType, Gotify: GotifyConfig{Token: "token"}},
+		{Name: "db", Type: NTFYType, CircuitBreaker: BreakerConfig{FailureThreshold: 3}},
+	}
+
+	routing, err := NewRouting(configs, nil, nil, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing: %s", err)
+	}
+
+	if all, ok := routing.Router.(*multiNotifier); !ok || len(all.destinations) != 2 {
+		t.Errorf("Router should deliver to every notifier, but got: %#v", routing.Router)
+	}
+	if _, ok := routing.Breakers["db"]; !ok || len(routing.Breakers) != 1 {
+		t.Errorf("Breakers were incorrect want only db, but got: %+v", routing.Breakers)
+	}
+}
+
+func Test_newRouting_invalid(t *testing.T) {
+	expectedErrors := []string{
+		"notifier desktop: gotify token is required",
+		"notifier desktop: invalid gotify timeout -1, must be a number greater than 0",
+		"notifier phones: invalid ntfy default priority 7, must be between 1 and 5 both included",
+		`notifier 3: name is required`,
+		`notifier pager: wrong notifier type "pager"`,
+		"notifier pager: invalid circuit breaker failure threshold -1, must be a positive number",
+		"route: unknown notifier missing",
+		"receiver ops: unknown notifier other",
+	}
+
+	configs := []Config{
+		{Name: "desktop", Type: GotifyType, Gotify: GotifyConfig{TimeoutMillis: -1}},
+		{Name: "phones", Type: NTFYType, NTFY: NTFYConfig{DefaultPriority: 7}},
+		{Type: NTFYType},
+		{Name: "pager", Type: "pager", CircuitBreaker: BreakerConfig{FailureThreshold: -1}},
+	}
+	route := &RouteConfig{Notifier: "missing"}
+	receiverConfigs := []ReceiverConfig{{Name: "ops", Notifiers: []string{"desktop", "other"}}}
+
+	_, err := NewRouting(configs, route, receiverConfigs, alertmanager.DefaultTemplate())
+	if err == nil {
+		t.Fatalf("Expected an error creating an invalid routing")
+	}
+
+	actualErrors := strings.Split(err.Error(), "\n")
+	if !reflect.DeepEqual(expectedErrors, actualErrors) {
+		t.Errorf("Errors were incorrect want: %+v, but got: %+v", expectedErrors, actualErrors)
+	}
+}
+
+func Test_routing_keepBreakerStates(t *testing.T) {
+	configs := []Config{
+		{Name: "ops", Type: GotifyType, Gotify: GotifyConfig{Token: "token"}, CircuitBreaker: BreakerConfig{FailureThreshold: 1}},
+		{Name: "db", Type: NTFYType, CircuitBreaker: BreakerConfig{FailureThreshold: 1}},
+	}
+	previous, err := NewRouting(configs, nil, nil, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing: %s", err)
+	}
+	previous.Breakers["ops"].record(false, true)
+	previous.Breakers["db"].record(false, true)
+
+	configs[1].NTFY.Topic = "db"
+	routing, err := NewRouting(configs, nil, nil, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing: %s", err)
+	}
+	routing.KeepBreakerStates(previous)
+
+	if state := routing.Breakers["ops"].State(); state != BreakerOpen {
+		t.Errorf("State of the unchanged notifier was incorrect want: %+v, but got: %+v", BreakerOpen, state)
+	}
+	if state := routing.Breakers["db"].State(); state != BreakerClosed {
+		t.Errorf("State of the changed notifier was incorrect want: %+v, but got: %+v", BreakerClosed, state)
+	}
+}
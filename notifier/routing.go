@@ -0,0 +1,239 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+// RouteConfig configures a route of the routing tree.
+type RouteConfig struct {
+	Matchers []string      `yaml:"matchers"`
+	Notifier string        `yaml:"notifier"`
+	Continue bool          `yaml:"continue"`
+	Routes   []RouteConfig `yaml:"routes"`
+}
+
+// ReceiverConfig maps a receiver, the last segment of the /alerts/{receiver}
+// endpoint, to the notifiers its alerts are delivered to.
+type ReceiverConfig struct {
+	Name      string   `yaml:"name"`
+	Notifiers []string `yaml:"notifiers"`
+}
+
+// Routing holds the notifiers alerts are delivered with.
+type Routing struct {
+	// Router delivers the alerts received on /alerts.
+	Router Notifier
+	// Receivers are the notifiers of each receiver by name.
+	Receivers map[string]Notifier
+	// Breakers are the circuit breakers of the notifiers that have one, by
+	// notifier name.
+	Breakers map[string]*Breaker
+	// Probes are the readiness checks of the notifiers, by notifier name.
+	Probes map[string]Probe
+
+	configs map[string]Config
+}
+
+// NewRouting creates the configured notifiers and the routing between them.
+// Without route, the router delivers every alert to all the notifiers. All
+// the problems found in the configuration are returned at once.
+func NewRouting(configs []Config, route *RouteConfig, receiverConfigs []ReceiverConfig, template *alertmanager.Template) (*Routing, error) {
+	errs := []error{}
+	if len(configs) == 0 {
+		errs = append(errs, fmt.Errorf("at least one notifier is required"))
+	}
+
+	notifiers := map[string]Notifier{}
+	configsByName := map[string]Config{}
+	breakers := map[string]*Breaker{}
+	probes := map[string]Probe{}
+	for i, config := range configs {
+		if len(config.Name) == 0 {
+			errs = append(errs, fmt.Errorf("notifier %d: name is required", i+1))
+			continue
+		}
+		if _, ok := notifiers[config.Name]; ok {
+			errs = append(errs, fmt.Errorf("notifier %s: defined more than once", config.Name))
+			continue
+		}
+		n, breaker, prober, err := newNotifier(config, template)
+		if err != nil {
+			errs = append(errs, prefixErrors("notifier "+config.Name, err))
+		}
+		notifiers[config.Name] = n
+		configsByName[config.Name] = config
+		if breaker != nil {
+			breakers[config.Name] = breaker
+		}
+		if prober != nil {
+			probes[config.Name] = Probe{Type: config.Type, Optional: config.Optional, Prober: prober}
+		}
+	}
+
+	// Fallbacks deliver to the notifiers without their own fallbacks, so
+	// they can't loop.
+	bases := maps.Clone(notifiers)
+	destinations := []Destination{}
+	for _, config := range configs {
+		n, ok := notifiers[config.Name]
+		if !ok || slices.ContainsFunc(destinations, func(d Destination) bool { return d.Name == config.Name }) {
+			continue
+		}
+		if len(config.Fallback.Notifiers) != 0 {
+			var err error
+			n, err = newFallback(config, bases)
+			if err != nil {
+				errs = append(errs, prefixErrors("notifier "+config.Name, err))
+			}
+			notifiers[config.Name] = n
+		}
+		destinations = append(destinations, Destination{Name: config.Name, Notifier: n})
+	}
+
+	var router Notifier
+	if route != nil {
+		r, err := newRoute(*route)
+		if err != nil {
+			errs = append(errs, prefixErrors("route", err))
+		} else {
+			router, err = NewRouter(r, notifiers)
+			if err != nil {
+				errs = append(errs, prefixErrors("route", err))
+			}
+		}
+	} else if len(destinations) == 1 {
+		router = destinations[0].Notifier
+	} else {
+		router = NewMulti(destinations...)
+	}
+
+	receivers := map[string]Notifier{}
+	for i, receiverConfig := range receiverConfigs {
+		if len(receiverConfig.Name) == 0 {
+			errs = append(errs, fmt.Errorf("receiver %d: name is required", i+1))
+			continue
+		}
+		if _, ok := receivers[receiverConfig.Name]; ok {
+			errs = append(errs, fmt.Errorf("receiver %s: defined more than once", receiverConfig.Name))
+			continue
+		}
+		receiver, err := newReceiver(receiverConfig, notifiers)
+		if err != nil {
+			errs = append(errs, prefixErrors("receiver "+receiverConfig.Name, err))
+		}
+		receivers[receiverConfig.Name] = receiver
+	}
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &Routing{Router: router, Receivers: receivers, Breakers: breakers, Probes: probes, configs: configsByName}, nil
+}
+
+// KeepBreakerStates carries the state of the circuit breakers of previous
+// over to the breakers of the notifiers with the same name and configuration,
+// so a reload doesn't close the circuits of the destinations that are down.
+func (r *Routing) KeepBreakerStates(previous *Routing) {
+	if previous == nil {
+		return
+	}
+	for name, breaker := range r.Breakers {
+		previousBreaker, ok := previous.Breakers[name]
+		if !ok || !reflect.DeepEqual(r.configs[name], previous.configs[name]) {
+			continue
+		}
+		breaker.restore(previousBreaker)
+	}
+}
+
+func newFallback(config Config, notifiers map[string]Notifier) (Notifier, error) {
+	errs := []error{}
+	destinations := []Destination{{Name: config.Name, Notifier: notifiers[config.Name]}}
+	for _, name := range config.Fallback.Notifiers {
+		n, ok := notifiers[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown fallback notifier %s", name))
+			continue
+		}
+		if name == config.Name {
+			errs = append(errs, fmt.Errorf("notifier can't be its own fallback"))
+			continue
+		}
+		destinations = append(destinations, Destination{Name: name, Notifier: n})
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return NewFallback(config.Fallback.On, destinations...), nil
+}
+
+func newReceiver(config ReceiverConfig, notifiers map[string]Notifier) (Notifier, error) {
+	if len(config.Notifiers) == 0 {
+		return nil, fmt.Errorf("no notifiers set")
+	}
+
+	errs := []error{}
+	destinations := []Destination{}
+	for _, name := range config.Notifiers {
+		n, ok := notifiers[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown notifier %s", name))
+			continue
+		}
+		destinations = append(destinations, Destination{Name: name, Notifier: n})
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if len(destinations) == 1 {
+		return destinations[0].Notifier, nil
+	}
+	return NewMulti(destinations...), nil
+}
+
+// prefixErrors prefixes every error joined in err with prefix, so each
+// problem is reported in its own line along with where it was found.
+func prefixErrors(prefix string, err error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+
+	errs := []error{}
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, prefixErrors(prefix, e))
+	}
+	return errors.Join(errs...)
+}
+
+func newRoute(config RouteConfig) (*Route, error) {
+	errs := []error{}
+	route := &Route{Notifier: config.Notifier, Continue: config.Continue}
+	for _, text := range config.Matchers {
+		matcher, err := ParseMatcher(text)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		route.Matchers = append(route.Matchers, matcher)
+	}
+	for _, childConfig := range config.Routes {
+		child, err := newRoute(childConfig)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		route.Routes = append(route.Routes, child)
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return route, nil
+}
@@ -0,0 +1,210 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urlPkg "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const (
+	slackWebhookURLEnvVariable    = "SLACK_WEBHOOK_URL"
+	slackTimeoutMillisEnvVariable = "SLACK_TIMEOUT_MILLIS"
+)
+
+// Limits of the slack attachments. Slack truncates longer messages at its
+// own, without regard to the formatting, so they are truncated before.
+const (
+	slackMaxTitleLength      = 256
+	slackMaxTextLength       = 8000
+	slackMaxFields           = 25
+	slackMaxFieldValueLength = 2000
+)
+
+// slackReplacer escapes the characters slack uses for links and mentions,
+// so alert text like <none> or <!channel> is shown as is.
+var slackReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// SlackConfig configures a slack notifier, or any service accepting slack
+// incoming webhooks, like mattermost. Fields not set are taken from the
+// environment variables.
+type SlackConfig struct {
+	// WebhookURL is the URL of the incoming webhook, which includes its
+	// token.
+	WebhookURL string `yaml:"webhook_url"`
+	// Username overrides the name of the webhook in the messages, if the
+	// service allows it.
+	Username      string `yaml:"username"`
+	TimeoutMillis int    `yaml:"timeout_millis"`
+}
+
+func (c *SlackConfig) setDefaults() error {
+	if len(c.WebhookURL) == 0 {
+		c.WebhookURL = os.Getenv(slackWebhookURLEnvVariable)
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getTimeoutMillisEnvVariable(slackTimeoutMillisEnvVariable)
+		if err != nil {
+			return err
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	return nil
+}
+
+type slackClient struct {
+	webhookURL string
+	username   string
+	template   *alertmanager.Template
+	timeout    time.Duration
+
+	httpClient http.Client
+}
+
+type slackMessage struct {
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text"`
+	Fields    []slackField `json:"fields,omitempty"`
+	Timestamp int64        `json:"ts,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// slackResponse is the body of the error responses of the services
+// answering in JSON, like mattermost. Slack answers in plain text.
+type slackResponse struct {
+	Message string `json:"message"`
+}
+
+// newSlackClient returns a slack client configured with config. All the
+// problems found in the configuration are returned at once.
+func newSlackClient(config SlackConfig, template *alertmanager.Template) (*slackClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(config.WebhookURL) == 0 {
+		errs = append(errs, fmt.Errorf("slack webhook url is required"))
+	} else if _, err := urlPkg.ParseRequestURI(config.WebhookURL); err != nil {
+		// The error is not included, as it contains the token.
+		errs = append(errs, fmt.Errorf("invalid slack webhook url"))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid slack timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &slackClient{
+		webhookURL: config.WebhookURL,
+		username:   config.Username,
+		template:   template,
+		timeout:    time.Duration(config.TimeoutMillis) * time.Millisecond,
+		httpClient: newHTTPClient(),
+	}, nil
+}
+
+func (s *slackClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, err := s.template.Render(data)
+	if err != nil {
+		return err
+	}
+
+	slackMessage := slackMessage{
+		Username:    s.username,
+		Attachments: []slackAttachment{slackAlertAttachment(data, title, message)},
+	}
+	body, err := json.Marshal(slackMessage)
+	if err != nil {
+		return fmt.Errorf("could not marshal slack message: %s", err)
+	}
+	return s.post(ctx, body)
+}
+
+// slackAlertAttachment returns the attachment of the alert, colored by its
+// status and severity, with a field per label. The texts are truncated
+// before being escaped, so no escape sequence is cut.
+func slackAlertAttachment(data *alertmanager.Data, title string, message string) slackAttachment {
+	title = slackReplacer.Replace(truncate(title, slackMaxTitleLength))
+	attachment := slackAttachment{
+		Fallback:  title,
+		Color:     fmt.Sprintf("#%06X", alertColor(data)),
+		Title:     title,
+		TitleLink: data.GeneratorURL,
+		Text:      slackReplacer.Replace(truncate(message, slackMaxTextLength)),
+	}
+	if !data.StartsAt.IsZero() {
+		attachment.Timestamp = data.StartsAt.Unix()
+	}
+	for _, label := range data.Labels.SortedPairs() {
+		if len(attachment.Fields) == slackMaxFields {
+			break
+		}
+		attachment.Fields = append(attachment.Fields, slackField{
+			Title: label.Name,
+			Value: slackReplacer.Replace(truncate(label.Value, slackMaxFieldValueLength)),
+			Short: true,
+		})
+	}
+	return attachment
+}
+
+// post posts the message to the webhook. Its URL is left out of the errors,
+// as it contains the token.
+func (s *slackClient) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(request)
+	if err != nil {
+		return newErrRedactedNotAvailable(redactURL(s.webhookURL), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newSlackError(resp)
+	}
+	return nil
+}
+
+// newSlackError returns the error for a failed response, with the error
+// reported in its body, like invalid_token, as message, if any. The delay to
+// retry is taken from the Retry-After header.
+func newSlackError(resp *http.Response) error {
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := strings.TrimSpace(string(content))
+	var body slackResponse
+	if json.Unmarshal(content, &body) == nil {
+		msg = body.Message
+	}
+	return newErrHTTPErrorFromResponse(resp, msg, 0)
+}
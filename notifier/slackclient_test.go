@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func Test_newSlackClient_invalidConfig(t *testing.T) {
+	_, err := newSlackClient(SlackConfig{}, alertmanager.DefaultTemplate())
+
+	if err == nil || !strings.Contains(err.Error(), "webhook url is required") {
+		t.Errorf("Expected an error for a missing webhook url, got: %v", err)
+	}
+}
+
+func Test_slackClientNotify(t *testing.T) {
+	messages := make(chan slackMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		err := json.NewDecoder(r.Body).Decode(&message)
+		if err != nil {
+			t.Errorf("Unexpected error decoding the request: %s", err)
+		}
+		messages <- message
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client, err := newSlackClient(SlackConfig{WebhookURL: server.URL + "/services/T0/B0/token", Username: "Alertmanager"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	alert := alertmanager.Alert{
+		Status:       "firing",
+		Labels:       alertmanager.KV{"alertname": "Disk_Full", "severity": "critical", "device": "<none>"},
+		Annotations:  alertmanager.KV{"description": "Usage is 95% & rising <!channel>"},
+		StartsAt:     time.Unix(1704067200, 0),
+		GeneratorURL: "https://prometheus/graph",
+	}
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	message := <-messages
+	if message.Username != "Alertmanager" {
+		t.Errorf("Username was incorrect want: %+v, but got: %+v", "Alertmanager", message.Username)
+	}
+	attachment := message.Attachments[0]
+	if attachment.Color != "#E01E5A" || attachment.TitleLink != alert.GeneratorURL || attachment.Timestamp != 1704067200 {
+		t.Errorf("Attachment was incorrect want: color #E01E5A, title link %s and ts 1704067200, but got: %+v", alert.GeneratorURL, attachment)
+	}
+	if !strings.Contains(attachment.Text, "Usage is 95% &amp; rising &lt;!channel&gt;") {
+		t.Errorf("Text should be escaped, got: %q", attachment.Text)
+	}
+	wantFields := []slackField{{Title: "alertname", Value: "Disk_Full", Short: true}, {Title: "device", Value: "&lt;none&gt;", Short: true}, {Title: "severity", Value: "critical", Short: true}}
+	if len(attachment.Fields) != len(wantFields) {
+		t.Fatalf("Fields were incorrect want: %+v, but got: %+v", wantFields, attachment.Fields)
+	}
+	for i, field := range attachment.Fields {
+		if field != wantFields[i] {
+			t.Errorf("Field was incorrect want: %+v, but got: %+v", wantFields[i], field)
+		}
+	}
+}
+
+func Test_slackAlertAttachment_limits(t *testing.T) {
+	attachment := slackAlertAttachment(alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "resolved"}), strings.Repeat("t", 300), strings.Repeat("&", 9000))
+
+	if length := len([]rune(attachment.Title)); length != slackMaxTitleLength {
+		t.Errorf("Title length was incorrect want: %d, but got: %d", slackMaxTitleLength, length)
+	}
+	if !strings.HasSuffix(attachment.Text, "&amp;…") || strings.Count(attachment.Text, "&amp;") != slackMaxTextLength-1 {
+		t.Errorf("Text should be truncated before being escaped, got %d characters", len(attachment.Text))
+	}
+	if attachment.Color != "#2EB67D" {
+		t.Errorf("Color was incorrect want: %+v, but got: %+v", "#2EB67D", attachment.Color)
+	}
+}
+
+func Test_slackClientNotify_errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     string
+		body           string
+		wantMsg        string
+		wantRetryAfter time.Duration
+	}{
+		{"slack", http.StatusForbidden, "", "invalid_token", "invalid_token", 0},
+		{"mattermost", http.StatusBadRequest, "", `{"id":"web.incoming_webhook.text.app_error","message":"No text specified."}`, "No text specified.", 0},
+		{"rate limit", http.StatusTooManyRequests, "30", "rate_limited", "rate_limited", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(tt.retryAfter) != 0 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			client, err := newSlackClient(SlackConfig{WebhookURL: server.URL + "/services/T0/B0/token"}, alertmanager.DefaultTemplate())
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %s", err)
+			}
+
+			err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+
+			var httpErr ErrHTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("Error was incorrect want: ErrHTTPError, but got: %+v", err)
+			}
+			if httpErr.Code() != tt.status || httpErr.msg != tt.wantMsg || httpErr.RetryAfter() != tt.wantRetryAfter {
+				t.Errorf("Error was incorrect want: %d %s %+v, but got: %d %s %+v", tt.status, tt.wantMsg, tt.wantRetryAfter, httpErr.Code(), httpErr.msg, httpErr.RetryAfter())
+			}
+		})
+	}
+}
+
+func Test_slackClient_spans(t *testing.T) {
+	exporter := recordSpans(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client, err := newSlackClient(SlackConfig{WebhookURL: server.URL + "/services/T0/B0/secret"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	checkSpansWithoutSecret(t, exporter, "secret")
+}
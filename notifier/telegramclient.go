@@ -0,0 +1,413 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/logging"
+)
+
+const (
+	telegramURLEnvVariable             = "TELEGRAM_URL"
+	telegramTokenEnvVariable           = "TELEGRAM_TOKEN"
+	telegramChatIDsEnvVariable         = "TELEGRAM_CHAT_IDS"
+	telegramParseModeEnvVariable       = "TELEGRAM_PARSE_MODE"
+	telegramTimeoutMillisEnvVariable   = "TELEGRAM_TIMEOUT_MILLIS"
+	telegramDefaultPriorityEnvVariable = "TELEGRAM_DEFAULT_PRIORITY"
+)
+
+// Parse modes of the telegram messages.
+const (
+	TelegramPlainText  string = ""
+	TelegramMarkdownV2 string = "MarkdownV2"
+	TelegramHTML       string = "HTML"
+)
+
+const (
+	telegramMaxMessageLength  = 4096
+	telegramRunbookAnnotation = "runbook_url"
+)
+
+// telegramMarkdownV2Replacer escapes the characters reserved by MarkdownV2.
+var telegramMarkdownV2Replacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// TelegramChat is a chat messages are sent to.
+type TelegramChat struct {
+	// ID is the id of the chat or the username of the channel, e.g.
+	// @alerts.
+	ID string `yaml:"id"`
+	// ThreadID is the forum topic of the chat, if any.
+	ThreadID int `yaml:"thread_id"`
+}
+
+// name returns the name identifying the chat and its forum topic, if any.
+func (c TelegramChat) name() string {
+	if c.ThreadID == 0 {
+		return "chat " + c.ID
+	}
+	return fmt.Sprintf("chat %s:%d", c.ID, c.ThreadID)
+}
+
+// TelegramConfig configures a telegram notifier. Fields not set are taken
+// from the environment variables.
+type TelegramConfig struct {
+	URL string `yaml:"url"`
+	// Token is the token of the bot sending the messages.
+	Token string         `yaml:"token"`
+	Chats []TelegramChat `yaml:"chats"`
+	// ParseMode is the formatting of the messages: MarkdownV2, HTML or
+	// empty for plain text.
+	ParseMode     string `yaml:"parse_mode"`
+	TimeoutMillis int    `yaml:"timeout_millis"`
+	// DefaultPriority is a pointer because 0 is a valid priority.
+	DefaultPriority *int `yaml:"default_priority"`
+	// SilentPriority is the priority up to which messages are sent without
+	// sound. It is a pointer because 0 is a valid priority, which silences
+	// no alert with a positive priority.
+	SilentPriority *int `yaml:"silent_priority"`
+}
+
+func (c *TelegramConfig) setDefaults() error {
+	errs := []error{}
+	if len(c.URL) == 0 {
+		c.URL = getTelegramURLEnvVariable()
+	}
+	if len(c.Token) == 0 {
+		c.Token = os.Getenv(telegramTokenEnvVariable)
+	}
+	if len(c.Chats) == 0 {
+		chats, err := getTelegramChatIDsEnvVariable()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.Chats = chats
+	}
+	if len(c.ParseMode) == 0 {
+		c.ParseMode = os.Getenv(telegramParseModeEnvVariable)
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getTimeoutMillisEnvVariable(telegramTimeoutMillisEnvVariable)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	if c.DefaultPriority == nil {
+		defaultPriority, err := getTelegramIntEnvVariable(telegramDefaultPriorityEnvVariable, 3)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		c.DefaultPriority = &defaultPriority
+	}
+	if c.SilentPriority == nil {
+		silentPriority := 1
+		c.SilentPriority = &silentPriority
+	}
+	return errors.Join(errs...)
+}
+
+type telegramClient struct {
+	baseURL         string
+	token           string
+	chats           []TelegramChat
+	parseMode       string
+	defaultPriority int
+	silentPriority  int
+	template        *alertmanager.Template
+	timeout         time.Duration
+
+	httpClient http.Client
+}
+
+type telegramMessage struct {
+	ChatID              string                     `json:"chat_id"`
+	MessageThreadID     int                        `json:"message_thread_id,omitempty"`
+	Text                string                     `json:"text"`
+	ParseMode           string                     `json:"parse_mode,omitempty"`
+	DisableNotification bool                       `json:"disable_notification,omitempty"`
+	LinkPreviewOptions  telegramLinkPreviewOptions `json:"link_preview_options"`
+	ReplyMarkup         *telegramInlineKeyboard    `json:"reply_markup,omitempty"`
+}
+
+type telegramLinkPreviewOptions struct {
+	IsDisabled bool `json:"is_disabled"`
+}
+
+type telegramInlineKeyboard struct {
+	InlineKeyboard [][]telegramButton `json:"inline_keyboard"`
+}
+
+type telegramButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// telegramResponse is the body of the telegram responses.
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// newTelegramClient returns a telegram client configured with config. All
+// the problems found in the configuration are returned at once.
+func newTelegramClient(config TelegramConfig, template *alertmanager.Template) (*telegramClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	_, err = joinURL(config.URL, "bot")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid telegram url: %s", err))
+	}
+	if len(config.Token) == 0 {
+		errs = append(errs, fmt.Errorf("telegram token is required"))
+	}
+	if len(config.Chats) == 0 {
+		errs = append(errs, fmt.Errorf("at least one telegram chat is required"))
+	}
+	for i, chat := range config.Chats {
+		if len(chat.ID) == 0 {
+			errs = append(errs, fmt.Errorf("telegram chat %d: id is required", i+1))
+		}
+	}
+	if config.ParseMode != TelegramPlainText && config.ParseMode != TelegramMarkdownV2 && config.ParseMode != TelegramHTML {
+		errs = append(errs, fmt.Errorf("invalid telegram parse mode %q, must be one of %s or %s", config.ParseMode, TelegramMarkdownV2, TelegramHTML))
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid telegram timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &telegramClient{
+		baseURL:         config.URL,
+		token:           config.Token,
+		chats:           config.Chats,
+		parseMode:       config.ParseMode,
+		defaultPriority: *config.DefaultPriority,
+		silentPriority:  *config.SilentPriority,
+		template:        template,
+		timeout:         time.Duration(config.TimeoutMillis) * time.Millisecond,
+		httpClient:      newHTTPClient(),
+	}, nil
+}
+
+// Notify sends the message to every chat. When the delivery to any of them
+// fails, the errors of the failed chats are returned in an ErrFanOut, or the
+// error alone when there is a single chat. When the delivery is tracked with
+// WithTracking, the chats the alert was already sent to are skipped, so a
+// retry only sends it to the failed ones.
+func (t *telegramClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, priority, err := alertmanager.ParseAlert(data, t.template, t.defaultPriority)
+	if err != nil {
+		return err
+	}
+
+	text := t.format(title, message)
+	keyboard := telegramButtons(data)
+	logger := logging.FromContext(ctx)
+	failedNames := []string{}
+	failedErrs := []error{}
+	for _, chat := range t.chats {
+		ctx, tracking := trackDestination(ctx, chat.name())
+		if tracking.delivered() {
+			logger.Info("Telegram message already sent, skipping it", "chat", chat.ID)
+			continue
+		}
+		telegramMessage := telegramMessage{
+			ChatID:              chat.ID,
+			MessageThreadID:     chat.ThreadID,
+			Text:                text,
+			ParseMode:           t.parseMode,
+			DisableNotification: priority <= t.silentPriority,
+			LinkPreviewOptions:  telegramLinkPreviewOptions{IsDisabled: true},
+			ReplyMarkup:         keyboard,
+		}
+		err := t.send(ctx, telegramMessage)
+		if err != nil {
+			logger.Warn("Telegram message not sent", "chat", chat.ID, logging.Error(err))
+			failedNames = append(failedNames, chat.name())
+			failedErrs = append(failedErrs, err)
+			continue
+		}
+		tracking.markDelivered()
+	}
+
+	if len(failedErrs) == 0 {
+		return nil
+	}
+	if len(t.chats) == 1 {
+		return failedErrs[0]
+	}
+	return NewErrFanOut(len(t.chats), failedNames, failedErrs)
+}
+
+// send sends the message. Telegram rejects the messages with buttons whose
+// URL it considers invalid, like URLs of internal hosts, so they are sent
+// again without buttons.
+func (t *telegramClient) send(ctx context.Context, message telegramMessage) error {
+	err := t.call(ctx, "sendMessage", message)
+	var e ErrHTTPError
+	if errors.As(err, &e) && message.ReplyMarkup != nil && e.Code() == http.StatusBadRequest && strings.Contains(e.msg, "BUTTON_URL_INVALID") {
+		logging.FromContext(ctx).Warn("Telegram rejected the URL buttons, sending the message without them", "chat", message.ChatID)
+		message.ReplyMarkup = nil
+		err = t.call(ctx, "sendMessage", message)
+	}
+	return err
+}
+
+// format returns the text of the message, the title in bold followed by the
+// message, escaped for the parse mode.
+func (t *telegramClient) format(title string, message string) string {
+	title = truncate(title, telegramMaxMessageLength)
+	message = truncate(message, max(telegramMaxMessageLength-len([]rune(title))-1, 1))
+	switch t.parseMode {
+	case TelegramMarkdownV2:
+		return fmt.Sprintf("*%s*\n%s", telegramMarkdownV2Replacer.Replace(title), telegramMarkdownV2Replacer.Replace(message))
+	case TelegramHTML:
+		return fmt.Sprintf("<b>%s</b>\n%s", html.EscapeString(title), html.EscapeString(message))
+	default:
+		return fmt.Sprintf("%s\n%s", title, message)
+	}
+}
+
+// telegramButtons returns the buttons linking to the runbook and the source of the
+// alert, nil when it has neither.
+func telegramButtons(data *alertmanager.Data) *telegramInlineKeyboard {
+	row := []telegramButton{}
+	if runbook := data.Annotations[telegramRunbookAnnotation]; len(runbook) != 0 {
+		row = append(row, telegramButton{Text: "Runbook", URL: runbook})
+	}
+	if len(data.GeneratorURL) != 0 {
+		row = append(row, telegramButton{Text: "Source", URL: data.GeneratorURL})
+	}
+	if len(row) == 0 {
+		return nil
+	}
+	return &telegramInlineKeyboard{InlineKeyboard: [][]telegramButton{row}}
+}
+
+// Probe checks telegram accepts the token and the bot can reach every chat.
+func (t *telegramClient) Probe(ctx context.Context) error {
+	err := t.call(ctx, "getMe", struct{}{})
+	if err != nil {
+		return err
+	}
+	for _, chat := range t.chats {
+		err = t.call(ctx, "getChat", map[string]string{"chat_id": chat.ID})
+		if err != nil {
+			return fmt.Errorf("telegram chat %s: %w", chat.ID, err)
+		}
+	}
+	return nil
+}
+
+// call calls the method of the bot API with the given parameters. The token
+// is left out of the errors, as it is part of the URL.
+func (t *telegramClient) call(ctx context.Context, method string, parameters any) error {
+	body, err := json.Marshal(parameters)
+	if err != nil {
+		return fmt.Errorf("could not marshal telegram %s request: %s", method, err)
+	}
+
+	url, err := joinURL(t.baseURL, "bot"+t.token, method)
+	if err != nil {
+		return fmt.Errorf("invalid telegram url: %s", err)
+	}
+	redactedURL, _ := joinURL(t.baseURL, "bot<token>", method)
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(request)
+	if err != nil {
+		return newErrRedactedNotAvailable(redactedURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newTelegramError(resp)
+	}
+	return nil
+}
+
+// newTelegramError returns the error for a failed response, with the
+// description and the delay to retry reported by telegram in its body, if
+// any.
+func newTelegramError(resp *http.Response) error {
+	var body telegramResponse
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(content, &body)
+	return newErrHTTPErrorFromResponse(resp, body.Description, time.Duration(body.Parameters.RetryAfter)*time.Second)
+}
+
+func getTelegramURLEnvVariable() string {
+	value := os.Getenv(telegramURLEnvVariable)
+	if len(value) != 0 {
+		return value
+	}
+	return "https://api.telegram.org"
+}
+
+// getTelegramChatIDsEnvVariable parses the comma separated list of chats,
+// each one an id optionally followed by a colon and the id of the forum
+// topic, e.g. -1001234567890:42.
+func getTelegramChatIDsEnvVariable() ([]TelegramChat, error) {
+	value := os.Getenv(telegramChatIDsEnvVariable)
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	chats := []TelegramChat{}
+	for _, chatValue := range strings.Split(value, ",") {
+		id, thread, found := strings.Cut(strings.TrimSpace(chatValue), ":")
+		chat := TelegramChat{ID: id}
+		if found {
+			threadID, err := strconv.Atoi(thread)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q, the topic of chat %s must be a number", telegramChatIDsEnvVariable, value, id)
+			}
+			chat.ThreadID = threadID
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+func getTelegramIntEnvVariable(name string, defaultValue int) (int, error) {
+	value := os.Getenv(name)
+	if len(value) != 0 {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q, must be a number", name, value)
+		}
+		return number, nil
+	}
+	return defaultValue, nil
+}
@@ -0,0 +1,318 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+type telegramRequest struct {
+	path    string
+	message telegramMessage
+}
+
+// telegramServer is a telegram stand-in recording the requests it receives
+// and answering them with respond.
+func telegramServer(t *testing.T, respond func(w http.ResponseWriter, message telegramMessage)) (*httptest.Server, chan telegramRequest) {
+	requests := make(chan telegramRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message telegramMessage
+		err := json.NewDecoder(r.Body).Decode(&message)
+		if err != nil {
+			t.Errorf("Unexpected error decoding the request: %s", err)
+		}
+		requests <- telegramRequest{path: r.URL.Path, message: message}
+		respond(w, message)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func respondOK(w http.ResponseWriter, message telegramMessage) {
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func Test_getTelegramChatIDsEnvVariable(t *testing.T) {
+	os.Setenv(telegramChatIDsEnvVariable, "-1001234567890:42, @alerts")
+	defer os.Unsetenv(telegramChatIDsEnvVariable)
+
+	chats, err := getTelegramChatIDsEnvVariable()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing chats: %s", err)
+	}
+	want := []TelegramChat{{ID: "-1001234567890", ThreadID: 42}, {ID: "@alerts"}}
+	if !reflect.DeepEqual(chats, want) {
+		t.Errorf("Chats were incorrect want: %+v, but got: %+v", want, chats)
+	}
+
+	os.Setenv(telegramChatIDsEnvVariable, "-100123:topic")
+	_, err = getTelegramChatIDsEnvVariable()
+	if err == nil {
+		t.Errorf("Expected an error for an invalid topic")
+	}
+}
+
+func Test_newTelegramClient_invalidConfig(t *testing.T) {
+	_, err := newTelegramClient(TelegramConfig{ParseMode: "Markdown"}, alertmanager.DefaultTemplate())
+
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid configuration")
+	}
+	for _, want := range []string{"token is required", "at least one telegram chat", "parse mode \"Markdown\""} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error should contain %q, got: %s", want, err)
+		}
+	}
+}
+
+func Test_newTelegramClient_invalidTimeoutEnvVariable(t *testing.T) {
+	for _, value := range []string{"0", "-1", "abc"} {
+		os.Setenv(telegramTimeoutMillisEnvVariable, value)
+
+		_, err := newTelegramClient(TelegramConfig{Token: "123:abc", Chats: []TelegramChat{{ID: "@alerts"}}}, alertmanager.DefaultTemplate())
+
+		want := fmt.Sprintf("invalid %s %q, must be a number greater than 0", telegramTimeoutMillisEnvVariable, value)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Error was incorrect want: %+v, but got: %+v", want, err)
+		}
+	}
+	os.Unsetenv(telegramTimeoutMillisEnvVariable)
+}
+
+func Test_telegramClientNotify(t *testing.T) {
+	server, requests := telegramServer(t, respondOK)
+	chats := []TelegramChat{{ID: "-100123", ThreadID: 42}, {ID: "@alerts"}}
+	client, err := newTelegramClient(TelegramConfig{URL: server.URL, Token: "123:abc", Chats: chats, ParseMode: TelegramMarkdownV2}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	alert := alertmanager.Alert{
+		Status:       "firing",
+		Labels:       alertmanager.KV{"alertname": "Disk_Full"},
+		Annotations:  alertmanager.KV{"priority": "1", "description": "Usage is 95.5% (threshold 90)", "runbook_url": "https://runbooks/disk"},
+		GeneratorURL: "https://prometheus/graph",
+	}
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	buttons := &telegramInlineKeyboard{InlineKeyboard: [][]telegramButton{{{Text: "Runbook", URL: "https://runbooks/disk"}, {Text: "Source", URL: "https://prometheus/graph"}}}}
+	for _, chat := range chats {
+		request := <-requests
+		if request.path != "/bot123:abc/sendMessage" {
+			t.Errorf("Path was incorrect want: %+v, but got: %+v", "/bot123:abc/sendMessage", request.path)
+		}
+		message := request.message
+		if message.ChatID != chat.ID || message.MessageThreadID != chat.ThreadID {
+			t.Errorf("Chat was incorrect want: %+v, but got: %s and %d", chat, message.ChatID, message.MessageThreadID)
+		}
+		if !strings.Contains(message.Text, `Usage is 95\.5% \(threshold 90\)`) || message.ParseMode != TelegramMarkdownV2 {
+			t.Errorf("Text should be escaped for MarkdownV2, got: %q", message.Text)
+		}
+		if !message.DisableNotification {
+			t.Errorf("Messages of low priority alerts should be silent")
+		}
+		if !reflect.DeepEqual(message.ReplyMarkup, buttons) {
+			t.Errorf("Buttons were incorrect want: %+v, but got: %+v", buttons, message.ReplyMarkup)
+		}
+	}
+}
+
+func Test_telegramClientNotify_zeroPriorities(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		name            string
+		defaultPriority *int
+		silentPriority  *int
+		wantSilent      bool
+	}{
+		{"defaults", nil, nil, false},
+		{"default priority 0", &zero, nil, true},
+		{"silent priority 0", &one, &zero, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := telegramServer(t, respondOK)
+			config := TelegramConfig{URL: server.URL, Token: "token", Chats: []TelegramChat{{ID: "1"}}, DefaultPriority: tt.defaultPriority, SilentPriority: tt.silentPriority}
+			client, err := newTelegramClient(config, alertmanager.DefaultTemplate())
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %s", err)
+			}
+
+			err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+			if err != nil {
+				t.Fatalf("Unexpected error notifying: %s", err)
+			}
+			if silent := (<-requests).message.DisableNotification; silent != tt.wantSilent {
+				t.Errorf("Silent was incorrect want: %+v, but got: %+v", tt.wantSilent, silent)
+			}
+		})
+	}
+}
+
+func Test_telegramClient_format(t *testing.T) {
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{TelegramPlainText, "Disk_Full [firing]\n<b>95%</b> & rising!"},
+		{TelegramMarkdownV2, "*Disk\\_Full \\[firing\\]*\n<b\\>95%</b\\> & rising\\!"},
+		{TelegramHTML, "<b>Disk_Full [firing]</b>\n&lt;b&gt;95%&lt;/b&gt; &amp; rising!"},
+	}
+	for _, test := range tests {
+		client := &telegramClient{parseMode: test.parseMode}
+		if got := client.format("Disk_Full [firing]", "<b>95%</b> & rising!"); got != test.want {
+			t.Errorf("Text in parse mode %q was incorrect want: %q, but got: %q", test.parseMode, test.want, got)
+		}
+	}
+}
+
+func Test_telegramClientNotify_invalidButtons(t *testing.T) {
+	server, requests := telegramServer(t, func(w http.ResponseWriter, message telegramMessage) {
+		if message.ReplyMarkup != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: BUTTON_URL_INVALID"}`))
+			return
+		}
+		respondOK(w, message)
+	})
+	client, err := newTelegramClient(TelegramConfig{URL: server.URL, Token: "token", Chats: []TelegramChat{{ID: "1"}}}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	alert := alertmanager.Alert{Status: "firing", GeneratorURL: "http://prometheus:9090/graph"}
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alert))
+	if err != nil {
+		t.Fatalf("Message should be sent again without buttons, got: %s", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Requests were incorrect want: 2, but got: %d", len(requests))
+	}
+}
+
+func Test_telegramClientNotify_tracking(t *testing.T) {
+	failing := "2"
+	server, requests := telegramServer(t, func(w http.ResponseWriter, message telegramMessage) {
+		if message.ChatID == failing {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		respondOK(w, message)
+	})
+	client, err := newTelegramClient(TelegramConfig{URL: server.URL, Token: "token", Chats: []TelegramChat{{ID: "1"}, {ID: "2", ThreadID: 7}}}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+	tracker := &fakeTracker{delivered: map[string]bool{}}
+	ctx := WithTracking(context.Background(), tracker, "alert")
+	data := alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"})
+
+	err = client.Notify(ctx, data)
+	var errFanOut ErrFanOut
+	if !errors.As(err, &errFanOut) || !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "chat 2:7: ") {
+		t.Fatalf("Error was incorrect want: ErrFanOut of chat 2:7, but got: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Requests were incorrect want: 2, but got: %d", len(requests))
+	}
+	for len(requests) != 0 {
+		<-requests
+	}
+
+	failing = ""
+	err = client.Notify(ctx, data)
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Only the failed chat should be retried, but got %d requests", len(requests))
+	}
+	if request := <-requests; request.message.ChatID != "2" {
+		t.Errorf("Chat was incorrect want: %+v, but got: %+v", "2", request.message.ChatID)
+	}
+	if !tracker.delivered["alert|chat 1"] || !tracker.delivered["alert|chat 2:7"] {
+		t.Errorf("Deliveries should be tracked by chat, but got: %+v", tracker.delivered)
+	}
+}
+
+func Test_telegramClientNotify_errors(t *testing.T) {
+	server, _ := telegramServer(t, func(w http.ResponseWriter, message telegramMessage) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`))
+	})
+	client, err := newTelegramClient(TelegramConfig{URL: server.URL, Token: "secret", Chats: []TelegramChat{{ID: "1"}, {ID: "2"}}}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	var errHTTPError ErrHTTPError
+	if !errors.As(err, &errHTTPError) || errHTTPError.Code() != http.StatusTooManyRequests {
+		t.Fatalf("Error was incorrect want: ErrHTTPError with code 429, but got: %#v", err)
+	}
+	if errHTTPError.RetryAfter() != 5*time.Second || !strings.Contains(err.Error(), "retry after 5") {
+		t.Errorf("Error should keep the description and delay of telegram, got: %s and %s", err, errHTTPError.RetryAfter())
+	}
+
+	server.Close()
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{}))
+	var errNotAvailable ErrNotAvailable
+	if !errors.As(err, &errNotAvailable) {
+		t.Fatalf("Error was incorrect want: ErrNotAvailable, but got: %#v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Error should not contain the token, got: %s", err)
+	}
+}
+
+func Test_telegramClientProbe(t *testing.T) {
+	server, requests := telegramServer(t, respondOK)
+	client, err := newTelegramClient(TelegramConfig{URL: server.URL, Token: "token", Chats: []TelegramChat{{ID: "-100123"}}}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Probe(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error probing telegram: %s", err)
+	}
+	for _, want := range []string{"/bottoken/getMe", "/bottoken/getChat"} {
+		if request := <-requests; request.path != want {
+			t.Errorf("Path was incorrect want: %+v, but got: %+v", want, request.path)
+		}
+	}
+}
+
+func Test_telegramClient_spans(t *testing.T) {
+	exporter := recordSpans(t)
+	server, _ := telegramServer(t, respondOK)
+	client, err := newTelegramClient(TelegramConfig{URL: server.URL, Token: "123:secret", Chats: []TelegramChat{{ID: "-100123"}}}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	err = client.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error probing telegram: %s", err)
+	}
+
+	checkSpansWithoutSecret(t, exporter, "secret")
+}
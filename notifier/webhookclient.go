@@ -0,0 +1,331 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urlPkg "net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const (
+	webhookURLEnvVariable           = "WEBHOOK_URL"
+	webhookTimeoutMillisEnvVariable = "WEBHOOK_TIMEOUT_MILLIS"
+)
+
+// Formats of the webhook bodies.
+const (
+	WebhookJSON string = "json"
+	WebhookForm string = "form"
+	WebhookText string = "text"
+)
+
+// Authentication types of the webhook requests.
+const (
+	WebhookBasicAuth  string = "basic"
+	WebhookBearerAuth string = "bearer"
+	WebhookHeaderAuth string = "header"
+)
+
+const (
+	webhookBodyTemplateName   = "webhook body"
+	webhookHeaderTemplateName = "webhook header "
+)
+
+var (
+	webhookMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	// webhookContentTypes are the content types of the body formats.
+	webhookContentTypes = map[string]string{
+		WebhookJSON: "application/json",
+		WebhookForm: "application/x-www-form-urlencoded",
+		WebhookText: "text/plain; charset=utf-8",
+	}
+
+	// webhookDefaultBodies are the bodies of the formats when no body is
+	// configured.
+	webhookDefaultBodies = map[string]string{
+		WebhookJSON: `{"title":{{ toJson .Title }},"message":{{ toJson .Message }},"receiver":{{ toJson .Receiver }},"alert":{{ toJson .Alert }}}`,
+		WebhookForm: `title={{ urlquery .Title }}&message={{ urlquery .Message }}&status={{ urlquery .Status }}`,
+		WebhookText: "{{ .Title }}\n{{ .Message }}",
+	}
+
+	headerNameRegexp = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+)
+
+// WebhookConfig configures a webhook notifier, which sends the alerts to any
+// HTTP receiver. Fields not set are taken from the environment variables.
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Method string `yaml:"method"`
+	// Headers are the headers of the requests. Their values are templates
+	// rendered like the body.
+	Headers map[string]string `yaml:"headers"`
+	// Format is the format of the body: json, form or text.
+	Format string `yaml:"format"`
+	// Body is the template of the body, rendered with the data of the
+	// alert along with its rendered .Title and .Message.
+	Body string            `yaml:"body"`
+	Auth WebhookAuthConfig `yaml:"auth"`
+	// SuccessStatusCodes are the status codes, or ranges of them like
+	// 200-299, that the receiver answers when it accepts the alert.
+	SuccessStatusCodes []string `yaml:"success_status_codes"`
+	TimeoutMillis      int      `yaml:"timeout_millis"`
+}
+
+// WebhookAuthConfig configures the authentication of the webhook requests.
+type WebhookAuthConfig struct {
+	// Type is basic, with Username and Password, bearer, with Token, or
+	// header, sending Token in Header. Empty disables authentication.
+	Type     string `yaml:"type"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	Header   string `yaml:"header"`
+}
+
+func (c *WebhookConfig) setDefaults() error {
+	if len(c.URL) == 0 {
+		c.URL = os.Getenv(webhookURLEnvVariable)
+	}
+	if len(c.Method) == 0 {
+		c.Method = http.MethodPost
+	}
+	if len(c.Format) == 0 {
+		c.Format = WebhookJSON
+	}
+	if len(c.SuccessStatusCodes) == 0 {
+		c.SuccessStatusCodes = []string{"200-299"}
+	}
+	if c.TimeoutMillis == 0 {
+		timeoutMillis, err := getTimeoutMillisEnvVariable(webhookTimeoutMillisEnvVariable)
+		if err != nil {
+			return err
+		}
+		c.TimeoutMillis = timeoutMillis
+	}
+	return nil
+}
+
+// validate returns all the problems found in the authentication at once.
+func (c WebhookAuthConfig) validate() error {
+	errs := []error{}
+	switch c.Type {
+	case "":
+	case WebhookBasicAuth:
+		if len(c.Username) == 0 {
+			errs = append(errs, fmt.Errorf("webhook basic auth username is required"))
+		}
+	case WebhookBearerAuth:
+		if len(c.Token) == 0 {
+			errs = append(errs, fmt.Errorf("webhook bearer auth token is required"))
+		}
+	case WebhookHeaderAuth:
+		if !headerNameRegexp.MatchString(c.Header) {
+			errs = append(errs, fmt.Errorf("invalid webhook auth header %q", c.Header))
+		}
+		if len(c.Token) == 0 {
+			errs = append(errs, fmt.Errorf("webhook header auth token is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid webhook auth type %q, must be one of %s, %s or %s", c.Type, WebhookBasicAuth, WebhookBearerAuth, WebhookHeaderAuth))
+	}
+	return errors.Join(errs...)
+}
+
+// statusCodeRange is an inclusive range of status codes.
+type statusCodeRange struct {
+	from, to int
+}
+
+type webhookClient struct {
+	url                string
+	method             string
+	headers            []string
+	format             string
+	auth               WebhookAuthConfig
+	successStatusCodes []statusCodeRange
+	template           *alertmanager.Template
+	timeout            time.Duration
+
+	httpClient http.Client
+}
+
+// webhookData is the data of the body and header templates.
+type webhookData struct {
+	*alertmanager.Data
+
+	Title   string
+	Message string
+}
+
+// newWebhookClient returns a webhook client configured with config. All the
+// problems found in the configuration are returned at once.
+func newWebhookClient(config WebhookConfig, template *alertmanager.Template) (*webhookClient, error) {
+	errs := []error{}
+	err := config.setDefaults()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(config.URL) == 0 {
+		errs = append(errs, fmt.Errorf("webhook url is required"))
+	} else if _, err := urlPkg.ParseRequestURI(config.URL); err != nil {
+		// The error is not included, as the URL may contain secrets.
+		errs = append(errs, fmt.Errorf("invalid webhook url"))
+	}
+	config.Method = strings.ToUpper(config.Method)
+	if !slices.Contains(webhookMethods, config.Method) {
+		errs = append(errs, fmt.Errorf("invalid webhook method %q, must be one of %s", config.Method, strings.Join(webhookMethods, ", ")))
+	}
+	if _, ok := webhookContentTypes[config.Format]; !ok {
+		errs = append(errs, fmt.Errorf("invalid webhook format %q, must be one of %s, %s or %s", config.Format, WebhookJSON, WebhookForm, WebhookText))
+	}
+	headers := make([]string, 0, len(config.Headers))
+	for name := range config.Headers {
+		if !headerNameRegexp.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid webhook header %q", name))
+		}
+		headers = append(headers, name)
+	}
+	slices.Sort(headers)
+	err = config.Auth.validate()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	successStatusCodes, err := parseStatusCodeRanges(config.SuccessStatusCodes)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if config.TimeoutMillis < 1 {
+		errs = append(errs, fmt.Errorf("invalid webhook timeout %d, must be a number greater than 0", config.TimeoutMillis))
+	}
+	body := config.Body
+	if len(body) == 0 {
+		body = webhookDefaultBodies[config.Format]
+	}
+	templates := map[string]string{webhookBodyTemplateName: body}
+	for name, value := range config.Headers {
+		templates[webhookHeaderTemplateName+name] = value
+	}
+	template, err = template.With(templates)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &webhookClient{
+		url:                config.URL,
+		method:             config.Method,
+		headers:            headers,
+		format:             config.Format,
+		auth:               config.Auth,
+		successStatusCodes: successStatusCodes,
+		template:           template,
+		timeout:            time.Duration(config.TimeoutMillis) * time.Millisecond,
+		httpClient:         newHTTPClient(),
+	}, nil
+}
+
+func (w *webhookClient) Notify(ctx context.Context, data *alertmanager.Data) error {
+	title, message, err := w.template.Render(data)
+	if err != nil {
+		return err
+	}
+	templateData := webhookData{Data: data, Title: title, Message: message}
+
+	body, err := w.template.Execute(webhookBodyTemplateName, templateData)
+	if err != nil {
+		return err
+	}
+	if w.format == WebhookJSON && !json.Valid([]byte(body)) {
+		return fmt.Errorf("rendered webhook body is not valid JSON, use toJson to quote the values: %s", truncate(body, 200))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, w.method, w.url, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err)
+	}
+	request.Header.Set("Content-Type", webhookContentTypes[w.format])
+	for _, name := range w.headers {
+		value, err := w.template.Execute(webhookHeaderTemplateName+name, templateData)
+		if err != nil {
+			return err
+		}
+		request.Header.Set(name, value)
+	}
+	w.authenticate(request)
+
+	resp, err := w.httpClient.Do(request)
+	if err != nil {
+		return newErrRedactedNotAvailable(redactURL(w.url), err)
+	}
+	defer resp.Body.Close()
+	if !w.success(resp.StatusCode) {
+		return newWebhookError(resp)
+	}
+	return nil
+}
+
+func (w *webhookClient) authenticate(request *http.Request) {
+	switch w.auth.Type {
+	case WebhookBasicAuth:
+		request.SetBasicAuth(w.auth.Username, w.auth.Password)
+	case WebhookBearerAuth:
+		request.Header.Set("Authorization", "Bearer "+w.auth.Token)
+	case WebhookHeaderAuth:
+		request.Header.Set(w.auth.Header, w.auth.Token)
+	}
+}
+
+func (w *webhookClient) success(statusCode int) bool {
+	for _, statusCodes := range w.successStatusCodes {
+		if statusCode >= statusCodes.from && statusCode <= statusCodes.to {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookError returns the error for a response with a status code not
+// considered successful, with the beginning of its body as message, if any.
+func newWebhookError(resp *http.Response) error {
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return newErrHTTPErrorFromResponse(resp, truncate(strings.TrimSpace(string(content)), 200), 0)
+}
+
+// parseStatusCodeRanges parses status codes and inclusive ranges of them,
+// like 200-299.
+func parseStatusCodeRanges(values []string) ([]statusCodeRange, error) {
+	ranges := make([]statusCodeRange, 0, len(values))
+	errs := []error{}
+	for _, value := range values {
+		fromValue, toValue, found := strings.Cut(value, "-")
+		if !found {
+			toValue = fromValue
+		}
+		from, fromErr := strconv.Atoi(strings.TrimSpace(fromValue))
+		to, toErr := strconv.Atoi(strings.TrimSpace(toValue))
+		if fromErr != nil || toErr != nil || from < 100 || to > 599 || from > to {
+			errs = append(errs, fmt.Errorf("invalid webhook success status codes %q, must be a status code or a range like 200-299", value))
+			continue
+		}
+		ranges = append(ranges, statusCodeRange{from: from, to: to})
+	}
+	return ranges, errors.Join(errs...)
+}
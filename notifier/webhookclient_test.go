@@ -0,0 +1,239 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// webhookServer is an HTTP receiver recording the requests it receives and
+// answering them with status.
+func webhookServer(t *testing.T, status int) (*httptest.Server, chan webhookRequest) {
+	requests := make(chan webhookRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Unexpected error reading the request: %s", err)
+		}
+		requests <- webhookRequest{method: r.Method, header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+		w.Write([]byte("rejected by receiver"))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func webhookTestData() *alertmanager.Data {
+	alert := alertmanager.Alert{
+		Status:      "firing",
+		Labels:      alertmanager.KV{"alertname": "Disk_Full", "severity": "critical", "team": "db"},
+		Annotations: alertmanager.KV{"summary": "Disk \"data\" full", "description": "Usage is 95%"},
+		Fingerprint: "abc123",
+	}
+	return alertmanager.NewData(alertmanager.RequestBody{Receiver: "db"}, alert)
+}
+
+func Test_newWebhookClient_invalidConfig(t *testing.T) {
+	config := WebhookConfig{
+		Method:             "TRACE",
+		Format:             "xml",
+		Headers:            map[string]string{"X Team": "db"},
+		Body:               "{{ .Title ",
+		Auth:               WebhookAuthConfig{Type: WebhookHeaderAuth},
+		SuccessStatusCodes: []string{"299-200", "ok"},
+	}
+	_, err := newWebhookClient(config, alertmanager.DefaultTemplate())
+
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid configuration")
+	}
+	for _, want := range []string{"url is required", "method \"TRACE\"", "format \"xml\"", "header \"X Team\"", "auth header \"\"", "auth token is required", "codes \"299-200\"", "codes \"ok\"", "webhook body template"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error should contain %q, got: %s", want, err)
+		}
+	}
+}
+
+func Test_webhookClientNotify_defaultBody(t *testing.T) {
+	server, requests := webhookServer(t, http.StatusOK)
+	client, err := newWebhookClient(WebhookConfig{URL: server.URL}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), webhookTestData())
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	request := <-requests
+	if request.method != http.MethodPost || request.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Request was incorrect want: POST application/json, but got: %s %s", request.method, request.header.Get("Content-Type"))
+	}
+	var body struct {
+		Title    string             `json:"title"`
+		Message  string             `json:"message"`
+		Receiver string             `json:"receiver"`
+		Alert    alertmanager.Alert `json:"alert"`
+	}
+	err = json.Unmarshal([]byte(request.body), &body)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding the body %s: %s", request.body, err)
+	}
+	if body.Title != `[FIRING][CRITICAL] Disk "data" full` || body.Message != "Usage is 95%" || body.Receiver != "db" {
+		t.Errorf("Body was incorrect, got: %+v", body)
+	}
+	if body.Alert.Fingerprint != "abc123" || !reflect.DeepEqual(body.Alert.Labels, webhookTestData().Labels) {
+		t.Errorf("Alert was incorrect want: %+v, but got: %+v", webhookTestData().Alert, body.Alert)
+	}
+}
+
+func Test_webhookClientNotify_templates(t *testing.T) {
+	server, requests := webhookServer(t, http.StatusOK)
+	config := WebhookConfig{
+		URL:     server.URL,
+		Method:  "put",
+		Format:  WebhookForm,
+		Headers: map[string]string{"X-Team": "{{ .Labels.team }}", "X-Static": "static"},
+		Body:    "text={{ urlquery .Title }}&fingerprint={{ .Fingerprint }}",
+		Auth:    WebhookAuthConfig{Type: WebhookBasicAuth, Username: "user", Password: "secret"},
+	}
+	client, err := newWebhookClient(config, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), webhookTestData())
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	request := <-requests
+	if request.method != http.MethodPut || request.header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("Request was incorrect want: PUT application/x-www-form-urlencoded, but got: %s %s", request.method, request.header.Get("Content-Type"))
+	}
+	if request.header.Get("X-Team") != "db" || request.header.Get("X-Static") != "static" {
+		t.Errorf("Headers were incorrect want: db and static, but got: %+v", request.header)
+	}
+	if username, password, ok := (&http.Request{Header: request.header}).BasicAuth(); !ok || username != "user" || password != "secret" {
+		t.Errorf("Basic auth was incorrect want: user and secret, but got: %s and %s", username, password)
+	}
+	form, err := url.ParseQuery(request.body)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding the body %s: %s", request.body, err)
+	}
+	if form.Get("text") != `[FIRING][CRITICAL] Disk "data" full` || form.Get("fingerprint") != "abc123" {
+		t.Errorf("Body was incorrect, got: %s", request.body)
+	}
+}
+
+func Test_webhookClientNotify_auth(t *testing.T) {
+	tests := []struct {
+		auth       WebhookAuthConfig
+		header     string
+		wantHeader string
+	}{
+		{WebhookAuthConfig{Type: WebhookBearerAuth, Token: "secret"}, "Authorization", "Bearer secret"},
+		{WebhookAuthConfig{Type: WebhookHeaderAuth, Header: "X-Api-Key", Token: "secret"}, "X-Api-Key", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.auth.Type, func(t *testing.T) {
+			server, requests := webhookServer(t, http.StatusOK)
+			client, err := newWebhookClient(WebhookConfig{URL: server.URL, Format: WebhookText, Auth: tt.auth}, alertmanager.DefaultTemplate())
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %s", err)
+			}
+
+			err = client.Notify(context.Background(), webhookTestData())
+			if err != nil {
+				t.Fatalf("Unexpected error notifying: %s", err)
+			}
+
+			request := <-requests
+			if request.header.Get(tt.header) != tt.wantHeader {
+				t.Errorf("Header %s was incorrect want: %+v, but got: %+v", tt.header, tt.wantHeader, request.header.Get(tt.header))
+			}
+			if request.body != "[FIRING][CRITICAL] Disk \"data\" full\nUsage is 95%" {
+				t.Errorf("Body was incorrect, got: %q", request.body)
+			}
+		})
+	}
+}
+
+func Test_webhookClientNotify_successStatusCodes(t *testing.T) {
+	tests := []struct {
+		status             int
+		successStatusCodes []string
+		wantErr            bool
+	}{
+		{http.StatusAccepted, nil, false},
+		{http.StatusAccepted, []string{"200", "204"}, true},
+		{http.StatusFound, []string{"200-299", "302"}, false},
+		{http.StatusBadRequest, nil, true},
+	}
+	for _, tt := range tests {
+		server, _ := webhookServer(t, tt.status)
+		client, err := newWebhookClient(WebhookConfig{URL: server.URL, SuccessStatusCodes: tt.successStatusCodes}, alertmanager.DefaultTemplate())
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %s", err)
+		}
+
+		err = client.Notify(context.Background(), webhookTestData())
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Error for status %d and success status codes %v was incorrect want error: %t, but got: %v", tt.status, tt.successStatusCodes, tt.wantErr, err)
+		}
+		var httpErr ErrHTTPError
+		if tt.wantErr && (!errors.As(err, &httpErr) || httpErr.Code() != tt.status || httpErr.msg != "rejected by receiver") {
+			t.Errorf("Error was incorrect want: ErrHTTPError %d rejected by receiver, but got: %+v", tt.status, err)
+		}
+	}
+}
+
+func Test_webhookClientNotify_invalidJSON(t *testing.T) {
+	server, requests := webhookServer(t, http.StatusOK)
+	client, err := newWebhookClient(WebhookConfig{URL: server.URL, Body: `{"title":"{{ .Title }}"}`}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), webhookTestData())
+
+	if err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("Expected an error for a body that is not valid JSON, got: %v", err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("No request should be made when the body is not valid JSON")
+	}
+}
+
+func Test_webhookClient_spans(t *testing.T) {
+	exporter := recordSpans(t)
+	server, _ := webhookServer(t, http.StatusOK)
+	client, err := newWebhookClient(WebhookConfig{URL: server.URL + "/hooks/secret?token=secret"}, alertmanager.DefaultTemplate())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %s", err)
+	}
+
+	err = client.Notify(context.Background(), webhookTestData())
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+
+	checkSpansWithoutSecret(t, exporter, "secret")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dcasado/alertmanager-notifier/config"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+)
+
+// readiness checks the destinations of the active notifiers. It is swapped
+// along with them on reloads, so results of the previous notifiers are not
+// reused.
+var readiness atomic.Pointer[notifier.Readiness]
+
+// readyResponse is the response to the readiness checks. Open circuit
+// breakers don't make the service not ready, as it still accepts alerts.
+type readyResponse struct {
+	Status          string                            `json:"status"`
+	Notifiers       map[string]notifier.BackendStatus `json:"notifiers"`
+	CircuitBreakers map[string]string                 `json:"circuitBreakers"`
+}
+
+func newReadiness(r *notifier.Routing, cfg *config.Config) *notifier.Readiness {
+	return notifier.NewReadiness(r.Probes, time.Duration(cfg.Ready.CacheMillis)*time.Millisecond)
+}
+
+// handleReady answers whether the destinations of all the required notifiers
+// are up, with the status of each of them and the state of the circuit
+// breakers.
+func handleReady(responseWriter http.ResponseWriter, request *http.Request) {
+	results, ready := readiness.Load().Check(request.Context())
+
+	response := readyResponse{Status: "ready", Notifiers: results, CircuitBreakers: circuitBreakers()}
+	statusCode := http.StatusOK
+	if !ready {
+		response.Status = "not ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(response)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/config"
+	"github.com/dcasado/alertmanager-notifier/logging"
+	"github.com/dcasado/alertmanager-notifier/notifier"
+)
+
+var reloadMutex sync.Mutex
+
+// newRouting creates the templates and notifiers set in the configuration.
+func newRouting(cfg *config.Config) (*notifier.Routing, error) {
+	template, err := alertmanager.NewTemplate(cfg.Templates.Title, cfg.Templates.Message, cfg.Templates.Files...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading templates: %s", err)
+	}
+
+	r, err := notifier.NewRouting(cfg.Notifiers, cfg.Route, cfg.Receivers, template)
+	if err != nil {
+		return nil, fmt.Errorf("error creating notifiers: %s", err)
+	}
+	return r, nil
+}
+
+// reload loads the configuration again and, if it is valid, swaps the active
+// notifiers with the new ones and applies the log level. The circuit breakers
+// of the notifiers whose configuration didn't change keep their state. When it is not
+// valid, the active notifiers are kept. Settings that can't be changed while
+// running are compared with the ones the service started with.
+func reload(configFile string, started *config.Config) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %s", err)
+	}
+	r, err := newRouting(cfg)
+	if err != nil {
+		return err
+	}
+	r.KeepBreakerStates(routing.Load())
+
+	if cfg.Listen != started.Listen {
+		slog.Warn("Listen settings changed, a restart is required to apply them")
+	}
+	if cfg.Log.Format != started.Log.Format {
+		slog.Warn("Log format changed, a restart is required to apply it")
+	}
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logging.Level.Set(level)
+	routing.Store(r)
+	readiness.Store(newReadiness(r, cfg))
+	return nil
+}
+
+// watchReloadSignal reloads the configuration every time the process receives
+// a SIGHUP.
+func watchReloadSignal(configFile string, started *config.Config) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			slog.Info("Reloading configuration on SIGHUP")
+			err := reload(configFile, started)
+			if err != nil {
+				slog.Error("Error reloading configuration", logging.Error(err))
+				continue
+			}
+			slog.Info("Configuration reloaded")
+		}
+	}()
+}
+
+func reloadHandler(configFile string, started *config.Config) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		slog.Info("Reloading configuration on request")
+		err := reload(configFile, started)
+		if err != nil {
+			slog.Error("Error reloading configuration", logging.Error(err))
+			http.Error(responseWriter, fmt.Sprintf("Failed to reload configuration: %s", err), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Configuration reloaded")
+		responseWriter.Write([]byte("Ok"))
+	}
+}
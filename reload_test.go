@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+	"github.com/dcasado/alertmanager-notifier/config"
+)
+
+// reloadServer returns a server receiving the text webhooks of the
+// configurations written by writeReloadConfig.
+func reloadServer(t *testing.T) (*httptest.Server, chan string) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, bodies
+}
+
+func writeReloadConfig(t *testing.T, path string, url string, title string) {
+	content := `
+templates:
+  title: '` + title + `'
+  message: 'message'
+notifiers:
+  - name: hook
+    type: webhook
+    webhook:
+      url: ` + url + `
+      format: text
+`
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("Unexpected error writing configuration file: %s", err)
+	}
+}
+
+// startReload loads the configuration at path like the service does when it
+// starts.
+func startReload(t *testing.T, path string) *config.Config {
+	started, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading configuration: %s", err)
+	}
+	r, err := newRouting(started)
+	if err != nil {
+		t.Fatalf("Unexpected error creating routing: %s", err)
+	}
+	routing.Store(r)
+	readiness.Store(newReadiness(r, started))
+	return started
+}
+
+func notifyRouter(t *testing.T, bodies chan string) string {
+	err := routing.Load().Router.Notify(context.Background(), alertmanager.NewData(alertmanager.RequestBody{}, alertmanager.Alert{Status: "firing"}))
+	if err != nil {
+		t.Fatalf("Unexpected error notifying: %s", err)
+	}
+	return <-bodies
+}
+
+func Test_reload(t *testing.T) {
+	server, bodies := reloadServer(t)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeReloadConfig(t, path, server.URL, "before")
+	started := startReload(t, path)
+	previous := routing.Load()
+
+	writeReloadConfig(t, path, server.URL, "after")
+	err := reload(path, started)
+	if err != nil {
+		t.Fatalf("Unexpected error reloading: %s", err)
+	}
+
+	if routing.Load() == previous {
+		t.Errorf("Routing should be replaced by the one of the new configuration")
+	}
+	if body := notifyRouter(t, bodies); body != "after\nmessage" {
+		t.Errorf("Body was incorrect want: %+v, but got: %+v", "after\nmessage", body)
+	}
+}
+
+func Test_reload_invalidConfig(t *testing.T) {
+	server, bodies := reloadServer(t)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeReloadConfig(t, path, server.URL, "before")
+	started := startReload(t, path)
+	previous := routing.Load()
+
+	writeReloadConfig(t, path, server.URL, "{{ .Unclosed")
+	err := reload(path, started)
+	if err == nil {
+		t.Errorf("Expected an error reloading an invalid configuration")
+	}
+
+	if routing.Load() != previous {
+		t.Errorf("Previous routing should be kept when the configuration is not valid")
+	}
+	if body := notifyRouter(t, bodies); body != "before\nmessage" {
+		t.Errorf("Body was incorrect want: %+v, but got: %+v", "before\nmessage", body)
+	}
+}
+
+func Test_reloadHandler(t *testing.T) {
+	server, _ := reloadServer(t)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeReloadConfig(t, path, server.URL, "before")
+	started := startReload(t, path)
+	handler := reloadHandler(path, started)
+
+	tests := []struct {
+		name           string
+		title          string
+		wantStatusCode int
+	}{
+		{"valid", "after", http.StatusOK},
+		{"invalid", "{{ .Unclosed", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeReloadConfig(t, path, server.URL, tt.title)
+			recorder := httptest.NewRecorder()
+
+			handler(recorder, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+
+			if recorder.Code != tt.wantStatusCode {
+				t.Errorf("Status code was incorrect want: %+v, but got: %+v", tt.wantStatusCode, recorder.Code)
+			}
+		})
+	}
+}
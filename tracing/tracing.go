@@ -0,0 +1,170 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+const (
+	serviceName = "alertmanager-notifier"
+	tracerName  = "github.com/dcasado/alertmanager-notifier"
+)
+
+// Attribute keys of the spans.
+const (
+	AlertnameKey   = attribute.Key("alertmanager.alert.name")
+	FingerprintKey = attribute.Key("alertmanager.alert.fingerprint")
+	StatusKey      = attribute.Key("alertmanager.alert.status")
+	SeverityKey    = attribute.Key("alertmanager.alert.severity")
+	ReceiverKey    = attribute.Key("alertmanager.receiver")
+	NotifierKey    = attribute.Key("notifier.name")
+	AttemptKey     = attribute.Key("notifier.attempt")
+	ResultKey      = attribute.Key("notifier.result")
+	DeadLetterKey  = attribute.Key("dead_letter.id")
+)
+
+func init() {
+	// The trace context is propagated even when tracing is disabled, so the
+	// traces of Alertmanager continue in the notification destinations.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup exports the spans to the OTLP/HTTP endpoint, the base URL of the
+// collector, sampling sampleRatio of the traces started by the service.
+// Traces started by Alertmanager follow its sampling decision. The returned
+// function flushes the spans left and stops exporting them.
+func Setup(ctx context.Context, endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	tracesURL, err := url.JoinPath(endpoint, "v1", "traces")
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing endpoint: %s", err)
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(tracesURL))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the tracing exporter: %s", err)
+	}
+
+	provider := NewProvider(sdktrace.WithBatcher(exporter), sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider identifying the service in the spans
+// with the given options, e.g. an in-memory exporter in tests.
+func NewProvider(options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	options = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	}, options...)
+	return sdktrace.NewTracerProvider(options...)
+}
+
+// Start starts a span, child of the span in ctx if any.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// SetAttributes sets the attributes on the span of ctx, if any.
+func SetAttributes(ctx context.Context, attributes ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attributes...)
+}
+
+// End ends the span, marking it as failed with err when not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// AlertAttributes returns the attributes identifying an alert.
+func AlertAttributes(alert alertmanager.Alert) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AlertnameKey.String(alert.Labels["alertname"]),
+		FingerprintKey.String(alert.Fingerprint),
+		StatusKey.String(alert.Status),
+		SeverityKey.String(alert.Labels["severity"]),
+	}
+}
+
+// Handler returns handler tracing the requests it serves with a span named
+// after the pattern, continuing the trace of the caller.
+func Handler(pattern string, handler http.HandlerFunc) http.Handler {
+	return otelhttp.NewHandler(handler, pattern, otelhttp.WithSpanNameFormatter(func(operation string, _ *http.Request) string {
+		return operation
+	}))
+}
+
+// Transport returns an HTTP transport tracing the requests it makes and
+// propagating the trace context to the destinations. The URL of the requests
+// is recorded in the spans as returned by redact, so the secrets some
+// destinations take in their URLs, like tokens, are not exported.
+func Transport(redact func(url string) string) http.RoundTripper {
+	return &transport{base: http.DefaultTransport, redact: redact}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	redact func(url string) string
+}
+
+func (t *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(tracerName).Start(request.Context(), "HTTP "+request.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(request.Method),
+		semconv.URLFull(t.redact(request.URL.String())),
+		semconv.ServerAddress(request.URL.Hostname()),
+	))
+	// Round trippers must not modify the request, so the trace context is
+	// injected in a copy.
+	request = request.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	resp, err := t.base.RoundTrip(request)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	span.End()
+	return resp, nil
+}
+
+// Inject returns the trace context of ctx, to store it along with work
+// continued later.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// StartLinked starts a span continuing work of the trace context returned by
+// Inject. It starts a new trace linked to the span of the trace context, as
+// the work continues after that trace ended.
+func StartLinked(ctx context.Context, name string, traceContext map[string]string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{trace.WithNewRoot(), trace.WithAttributes(attributes...)}
+	spanContext := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(traceContext)))
+	if spanContext.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: spanContext}))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, options...)
+}
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/dcasado/alertmanager-notifier/alertmanager"
+)
+
+func setupTestProvider(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(NewProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func Test_Handler(t *testing.T) {
+	exporter := setupTestProvider(t)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var alertSpan trace.Span
+	handler := Handler("POST /alerts", func(w http.ResponseWriter, r *http.Request) {
+		alert := alertmanager.Alert{Status: "firing", Fingerprint: "f1", Labels: map[string]string{"alertname": "HighLatency"}}
+		_, alertSpan = Start(r.Context(), "alert", AlertAttributes(alert)...)
+		End(alertSpan, errors.New("connection refused"))
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/alerts", nil)
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Spans were incorrect want: 2, but got: %d", len(spans))
+	}
+	alert, server := spans[0], spans[1]
+	if server.Name != "POST /alerts" || server.SpanContext.TraceID().String() != traceID {
+		t.Errorf("Server span should continue the trace of the request, got name %s and trace %s", server.Name, server.SpanContext.TraceID())
+	}
+	if alert.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("Alert span should be a child of the server span")
+	}
+	if alert.Status.Code != codes.Error || len(alert.Events) != 1 {
+		t.Errorf("Alert span should record the error, got status %+v and events %+v", alert.Status, alert.Events)
+	}
+	want := map[string]string{string(AlertnameKey): "HighLatency", string(FingerprintKey): "f1", string(StatusKey): "firing"}
+	for _, attribute := range alert.Attributes {
+		if value, ok := want[string(attribute.Key)]; ok && attribute.Value.AsString() != value {
+			t.Errorf("Attribute %s was incorrect want: %s, but got: %s", attribute.Key, value, attribute.Value.AsString())
+		}
+	}
+}
+
+func Test_StartLinked(t *testing.T) {
+	exporter := setupTestProvider(t)
+
+	ctx, span := Start(context.Background(), "alert")
+	traceContext := Inject(ctx)
+	span.End()
+	if len(traceContext["traceparent"]) == 0 {
+		t.Fatalf("Trace context should have a traceparent, got: %+v", traceContext)
+	}
+
+	_, linked := StartLinked(context.Background(), "queued alert", traceContext)
+	linked.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Spans were incorrect want: 2, but got: %d", len(spans))
+	}
+	if len(spans[1].Links) != 1 || spans[1].Links[0].SpanContext.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("Span should be linked to the span of the trace context, got links: %+v", spans[1].Links)
+	}
+	if spans[1].SpanContext.TraceID() == spans[0].SpanContext.TraceID() {
+		t.Errorf("Linked span should start a new trace")
+	}
+
+	if Inject(context.Background()) != nil {
+		t.Errorf("Trace context of a context without span should be nil")
+	}
+}
+
+func Test_Transport(t *testing.T) {
+	exporter := setupTestProvider(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := http.Client{Transport: Transport(func(url string) string { return "redacted" })}
+
+	ctx, parent := Start(context.Background(), "notifier attempt")
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/bot123:secret/sendMessage?token=secret", nil)
+	resp, err := client.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error making the request: %s", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Spans were incorrect want: 2, but got: %d", len(spans))
+	}
+	requestSpan := spans[0]
+	if requestSpan.Name != "HTTP POST" || requestSpan.SpanKind != trace.SpanKindClient || requestSpan.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Request span should be a client span child of the caller span, got: %s %s", requestSpan.Name, requestSpan.SpanKind)
+	}
+	if requestSpan.Status.Code != codes.Error {
+		t.Errorf("Request span should be failed for a 404 response, got status: %+v", requestSpan.Status)
+	}
+	for _, attribute := range requestSpan.Attributes {
+		if strings.Contains(attribute.Value.Emit(), "secret") {
+			t.Errorf("Attribute %s should not contain the secrets of the URL, got: %s", attribute.Key, attribute.Value.Emit())
+		}
+		if attribute.Key == "url.full" && attribute.Value.AsString() != "redacted" {
+			t.Errorf("URL was incorrect want: redacted, but got: %s", attribute.Value.AsString())
+		}
+	}
+	if !strings.Contains(traceparent, requestSpan.SpanContext.SpanID().String()) {
+		t.Errorf("Trace context of the request span should be propagated, got traceparent: %q", traceparent)
+	}
+}